@@ -2,22 +2,144 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// teamNameCollation compares team and tournament names without case
+var teamNameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// EnsureIndexes creates the indexes the handlers rely on for uniqueness,
+// failures are logged so a dirty collection does not stop the server
+func EnsureIndexes(db *mongo.Database) {
+	indexes := map[string][]mongo.IndexModel{
+		"PersonalDetails": {
+			{
+				// a uuid is one account's, sign up refuses one in use
+				Keys:    bson.D{{Key: "user_uuid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"UsersGameInformation": {
+			{
+				Keys:    bson.D{{Key: "user_uuid", Value: 1}, {Key: "gameid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "gameid", Value: 1}, {Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"Teams": {
+			{
+				Keys:    bson.D{{Key: "teamid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "gameid", Value: 1}, {Key: "teamname", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetCollation(teamNameCollation),
+			},
+		},
+		"Tournaments": {
+			{
+				Keys: bson.D{{Key: "tournamentid", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"tournamentid": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys: bson.D{{Key: "slug", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys: bson.D{{Key: "gameid", Value: 1}, {Key: "title", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetCollation(teamNameCollation),
+			},
+			{
+				// the default listing order
+				Keys: bson.D{{Key: "status", Value: 1}, {Key: "tournamentstartdate", Value: 1}, {Key: "tournamentid", Value: 1}},
+			},
+		},
+		"ScrimLobbies": {
+			{
+				Keys:    bson.D{{Key: "lobbyid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				// a scrim gets one lobby per start however often lobbies are generated
+				Keys:    bson.D{{Key: "scrimid", Value: 1}, {Key: "startingat", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"TournamentTemplates": {
+			{
+				Keys:    bson.D{{Key: "templateid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "gameid", Value: 1}, {Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetCollation(teamNameCollation),
+			},
+		},
+	}
+	for collection, models := range indexes {
+		_, err := db.Collection(collection).Indexes().CreateMany(context.TODO(), models)
+		if err != nil {
+			log.Println("> Index on " + collection + " failed: " + err.Error())
+		}
+	}
+}
+
+// normalizeUserCountry stores known countries as their ISO code
+func normalizeUserCountry(user *User) {
+	if code, ok := NormalizeCountry(user.Country); ok {
+		user.Country = code
+	}
+}
+
+// uuidAvailable is true for a new user's uuid no account uses yet, the
+// unique index on user_uuid backs it against concurrent sign ups
+func uuidAvailable(db *mongo.Database, uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+	count, err := db.Collection("PersonalDetails").CountDocuments(context.TODO(), bson.M{"user_uuid": uuid})
+	return err == nil && count == 0
+}
+
 func SignUpUser(db *mongo.Database, user *User) bool {
 	status := true
-	_, err := db.Collection("PersonalDetails").InsertOne(
+	user.Role = ""
+	normalizeUserCountry(user)
+	if !uuidAvailable(db, user.User_uuid) {
+		log.Println("User uuid " + user.User_uuid + " is empty or taken")
+		return false
+	}
+	res, err := db.Collection("PersonalDetails").InsertOne(
 		context.TODO(), user,
 	)
 	if err != nil {
 		log.Printf(err.Error())
 		status = false
+	} else if err := saveSignUpGameInfo(db, user, res.InsertedID); err != nil {
+		log.Println(err)
+		status = false
 	} else {
 		log.Printf("Success")
 		status = true
@@ -25,6 +147,30 @@ func SignUpUser(db *mongo.Database, user *User) bool {
 	return status
 }
 
+// saveSignUpGameInfo moves the game profiles sent at sign up into
+// UsersGameInformation, they are not kept on the user document. When one
+// cannot be saved the documents this sign up created, the user inserted as
+// userID and its profiles so far, are removed again so it fails whole.
+func saveSignUpGameInfo(db *mongo.Database, user *User, userID interface{}) error {
+	created := []interface{}{}
+	for i := 0; i < len(user.UsersGamesInformation); i++ {
+		user.UsersGamesInformation[i].User_uuid = user.User_uuid
+		profileID, ok := saveGameProfile(db, &user.UsersGamesInformation[i])
+		if !ok {
+			if len(created) > 0 {
+				db.Collection("UsersGameInformation").DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": created}})
+			}
+			db.Collection("PersonalDetails").DeleteOne(context.TODO(), bson.M{"_id": userID})
+			return errors.New("game profile for " + user.UsersGamesInformation[i].GameID +
+				" could not be saved, its in game ID may be taken")
+		}
+		if profileID != nil {
+			created = append(created, profileID)
+		}
+	}
+	return nil
+}
+
 func SignUpWithCode(db *mongo.Database, user *User, code string) bool {
 	status := true
 	resp := db.Collection("ReferenceInfo").FindOne(context.TODO(), bson.M{"code": code})
@@ -32,15 +178,24 @@ func SignUpWithCode(db *mongo.Database, user *User, code string) bool {
 	signeeReward := 100
 	referrerReward := 200
 	resp.Decode(&refer)
+	user.Role = ""
+	normalizeUserCountry(user)
 	if refer.Code == code {
 		user.UserWallet.Bonus_cash = signeeReward
+		if !uuidAvailable(db, user.User_uuid) {
+			log.Println("User uuid " + user.User_uuid + " is empty or taken")
+			return false
+		}
 
-		_, err := db.Collection("PersonalDetails").InsertOne(
+		res, err := db.Collection("PersonalDetails").InsertOne(
 			context.TODO(), user,
 		)
 		if err != nil {
 			log.Printf(err.Error())
 			status = false
+		} else if err := saveSignUpGameInfo(db, user, res.InsertedID); err != nil {
+			log.Println(err)
+			status = false
 		} else {
 			log.Printf("Success")
 			status = true
@@ -73,6 +228,9 @@ func UnRegUser(db *mongo.Database, user *User) bool {
 
 func UpdateUser(db *mongo.Database, user *User) bool {
 	status := true
+	// roles are only granted by hand, never through this endpoint
+	user.Role = GetUserDetails(db, user.Email).Role
+	normalizeUserCountry(user)
 	_, err := db.Collection("PersonalDetails").UpdateOne(context.TODO(), bson.M{
 		"email": user.Email,
 	}, bson.M{"$set": user}, options.Update().SetUpsert(true))
@@ -117,6 +275,7 @@ func GetUserDetails(db *mongo.Database, email string) User {
 	var userInformation User
 	resp.Decode(&userInformation)
 	userInformation.Password = ""
+	userInformation.UsersGamesInformation = GetUsersGameInfo(db, userInformation.User_uuid)
 	return userInformation
 }
 
@@ -125,11 +284,31 @@ func GetUserDetailsUUID(db *mongo.Database, uuid string) User {
 	var userInformation User
 	resp.Decode(&userInformation)
 	userInformation.Password = ""
+	userInformation.UsersGamesInformation = GetUsersGameInfo(db, userInformation.User_uuid)
 	return userInformation
 }
 
 func AddTeam(db *mongo.Database, team *Team) bool {
 	status := true
+	if team.TeamID == "" {
+		team.TeamID = primitive.NewObjectID().Hex()
+	}
+	// ratings are the organizers' to give, see SetTeamRating
+	team.Rating = 0
+	if IsTeamNameTaken(db, team.GameID, team.TeamName, team.TeamID) {
+		log.Println("Team name " + team.TeamName + " is taken for " + team.GameID)
+		return false
+	}
+	if team.CaptainID == "" && len(team.UsersInTeam) > 0 {
+		team.CaptainID = team.UsersInTeam[0].User_uuid
+	}
+	for i, member := range team.UsersInTeam {
+		if !HasGameProfile(db, member.User_uuid, team.GameID) {
+			log.Println("User " + member.User_uuid + " has no profile for game " + team.GameID)
+			return false
+		}
+		team.UsersInTeam[i] = rosterMember(member)
+	}
 	_, err := db.Collection("Teams").InsertOne(
 		context.TODO(), team,
 	)
@@ -146,30 +325,55 @@ func AddTeam(db *mongo.Database, team *Team) bool {
 	return status
 }
 
+// rosterMember is the copy of a user kept in a team roster, rosters are
+// shown to anyone so they carry no contact details or wallet
+func rosterMember(user User) User {
+	return User{
+		User_uuid:    user.User_uuid,
+		Fname:        user.Fname,
+		Lname:        user.Lname,
+		Country:      user.Country,
+		ProfileImage: user.ProfileImage,
+	}
+}
+
 func AddTeamMember(db *mongo.Database, teamMember User, teamid string) bool {
-	status := true
-	resp, err := db.Collection("Teams").Find(context.TODO(), bson.M{"teamid": teamid})
-	for resp.Next(context.TODO()) {
-		var teamTemp Team
-		resp.Decode(&teamTemp)
-		// teamTemp.UsersInTeam = append(teamTemp.UsersInTeam, teamMember)
-		teamTemp.UsersInTeam = append(teamTemp.UsersInTeam, teamMember)
-		_, err := db.Collection("Teams").UpdateOne(context.TODO(),
-			bson.M{"teamid": teamid}, bson.M{"$set": teamTemp})
-		if err != nil {
-			log.Println(err)
-		} else {
-			log.Println("Added user " + teamMember.User_uuid + " to team " + teamid)
-		}
+	if teamMember.User_uuid == "" {
+		return false
+	}
+	if IsRosterLocked(db, teamid) {
+		log.Println("Roster of team " + teamid + " is locked")
+		return false
 	}
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(), bson.M{"teamid": teamid}).Decode(&team)
 	if err != nil {
-		log.Printf(err.Error())
-		status = false
-	} else {
-		log.Printf("Success")
-		status = true
+		log.Println("No team " + teamid)
+		return false
 	}
-	return status
+	if !HasGameProfile(db, teamMember.User_uuid, team.GameID) {
+		log.Println("User " + teamMember.User_uuid + " has no profile for game " + team.GameID)
+		return false
+	}
+	if title, barred := memberIneligibleForTeam(db, teamid, teamMember); barred {
+		log.Println("User " + teamMember.User_uuid + " is not eligible for " + title + " the team is entered in")
+		return false
+	}
+	// pushing only while the user is not on the roster keeps two accepted
+	// invites or a retried request from adding them twice
+	res, err := db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": teamid, "usersinteam.user_uuid": bson.M{"$ne": teamMember.User_uuid}},
+		bson.M{"$push": bson.M{"usersinteam": rosterMember(teamMember)}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if res.MatchedCount == 0 {
+		log.Println("User " + teamMember.User_uuid + " is already in team " + teamid)
+		return false
+	}
+	log.Println("Added user " + teamMember.User_uuid + " to team " + teamid)
+	return true
 }
 
 func splice(array []User, nameToRem string) []User {
@@ -185,6 +389,10 @@ func splice(array []User, nameToRem string) []User {
 
 func DelTeamMember(db *mongo.Database, teamMember *User, teamid string) bool {
 	status := true
+	if IsRosterLocked(db, teamid) {
+		log.Println("Roster of team " + teamid + " is locked")
+		return false
+	}
 	resp, err := db.Collection("Teams").Find(context.TODO(), bson.M{"teamid": teamid})
 	for resp.Next(context.TODO()) {
 		var teamTemp Team
@@ -209,19 +417,292 @@ func DelTeamMember(db *mongo.Database, teamMember *User, teamid string) bool {
 	return status
 }
 
-func AddUsersGameInfo(db *mongo.Database, gameInformationOfUser *GameInformationOfUser) bool {
-	status := true
-	_, err := db.Collection("UsersGameInformation").InsertOne(
-		context.TODO(), gameInformationOfUser,
-	)
+// MigrateLegacyUsers moves the game profiles users kept embedded in
+// PersonalDetails into UsersGameInformation. A profile that cannot move, its
+// in game ID being taken, is left on the user and logged.
+func MigrateLegacyUsers(db *mongo.Database) {
+	res, err := db.Collection("PersonalDetails").Find(context.TODO(),
+		bson.M{"usersgamesinformation.0": bson.M{"$exists": true}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			User_uuid             string
+			UsersGamesInformation []GameInformationOfUser
+		}
+		res.Decode(&legacy)
+		left := []GameInformationOfUser{}
+		for _, profile := range legacy.UsersGamesInformation {
+			profile.User_uuid = legacy.User_uuid
+			if HasGameProfile(db, legacy.User_uuid, profile.GameID) {
+				continue
+			}
+			if _, ok := saveGameProfile(db, &profile); !ok {
+				log.Println("> Game profile " + profile.GameID + " of user " + legacy.User_uuid + " was not migrated")
+				left = append(left, profile)
+			}
+		}
+		update := bson.M{"$unset": bson.M{"usersgamesinformation": ""}}
+		if len(left) > 0 {
+			update = bson.M{"$set": bson.M{"usersgamesinformation": left}}
+		}
+		_, err := db.Collection("PersonalDetails").UpdateOne(context.TODO(),
+			bson.M{"user_uuid": legacy.User_uuid}, update)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// AddUsersGameInfo creates or replaces the requester's profile for a game,
+// the in game ID can only belong to one user per game
+func AddUsersGameInfo(db *mongo.Database, requester User, gameInformationOfUser *GameInformationOfUser) bool {
+	gameInformationOfUser.User_uuid = requester.User_uuid
+	_, ok := saveGameProfile(db, gameInformationOfUser)
+	return ok
+}
+
+// saveGameProfile upserts a profile for its User_uuid, the _id is returned
+// when it created a new document
+func saveGameProfile(db *mongo.Database, gameInformationOfUser *GameInformationOfUser) (interface{}, bool) {
+	if gameInformationOfUser.User_uuid == "" || gameInformationOfUser.GameID == "" ||
+		gameInformationOfUser.ID == "" {
+		return nil, false
+	}
+	taken, err := db.Collection("UsersGameInformation").CountDocuments(context.TODO(), bson.M{
+		"gameid":    gameInformationOfUser.GameID,
+		"id":        gameInformationOfUser.ID,
+		"user_uuid": bson.M{"$ne": gameInformationOfUser.User_uuid},
+	})
+	if err != nil || taken > 0 {
+		log.Println("In game ID " + gameInformationOfUser.ID + " is already linked for " + gameInformationOfUser.GameID)
+		return nil, false
+	}
+	res, err := db.Collection("UsersGameInformation").UpdateOne(context.TODO(),
+		bson.M{"user_uuid": gameInformationOfUser.User_uuid, "gameid": gameInformationOfUser.GameID},
+		bson.M{"$set": gameInformationOfUser}, options.Update().SetUpsert(true))
 	if err != nil {
 		log.Printf(err.Error())
-		status = false
-	} else {
-		log.Printf("Success")
-		status = true
+		return nil, false
 	}
-	return status
+	log.Printf("Success")
+	return res.UpsertedID, true
+}
+
+func GetUsersGameInfo(db *mongo.Database, uuid string) []GameInformationOfUser {
+	profiles := []GameInformationOfUser{}
+	if uuid == "" {
+		return profiles
+	}
+	res, err := db.Collection("UsersGameInformation").Find(context.TODO(), bson.M{"user_uuid": uuid})
+	if err != nil {
+		log.Println(err)
+		return profiles
+	}
+	for res.Next(context.TODO()) {
+		var profile GameInformationOfUser
+		res.Decode(&profile)
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+func HasGameProfile(db *mongo.Database, uuid string, gameid string) bool {
+	count, err := db.Collection("UsersGameInformation").CountDocuments(context.TODO(),
+		bson.M{"user_uuid": uuid, "gameid": gameid})
+	return err == nil && count > 0
+}
+
+// AddRecruitmentPost puts a player's availability or a team's open slots on
+// the board
+func AddRecruitmentPost(db *mongo.Database, requester User, post RecruitmentPost) bool {
+	switch post.Kind {
+	case "lft":
+		post.User_uuid = requester.User_uuid
+		post.TeamID = ""
+		var profile GameInformationOfUser
+		err := db.Collection("UsersGameInformation").FindOne(context.TODO(),
+			bson.M{"user_uuid": requester.User_uuid, "gameid": post.GameID}).Decode(&profile)
+		if err != nil {
+			log.Println("User " + requester.User_uuid + " has no profile for game " + post.GameID)
+			return false
+		}
+		if post.Rank == "" {
+			post.Rank = profile.Rank
+		}
+		if post.Region == "" {
+			post.Region = profile.Region
+		}
+	case "lfp":
+		var team Team
+		err := db.Collection("Teams").FindOne(context.TODO(),
+			bson.M{"teamid": post.TeamID}).Decode(&team)
+		if err != nil || !CanEditTeam(db, requester, post.TeamID) {
+			log.Println("Only the captain can post open slots for team " + post.TeamID)
+			return false
+		}
+		post.GameID = team.GameID
+		post.User_uuid = requester.User_uuid
+		if post.Slots < 1 {
+			post.Slots = 1
+		}
+	default:
+		return false
+	}
+	post.PostID = primitive.NewObjectID().Hex()
+	post.Open = true
+	post.CreatedAt = time.Now().UTC()
+	_, err := db.Collection("RecruitmentPosts").InsertOne(context.TODO(), post)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+func CloseRecruitmentPost(db *mongo.Database, requester User, postid string) bool {
+	var post RecruitmentPost
+	err := db.Collection("RecruitmentPosts").FindOne(context.TODO(),
+		bson.M{"postid": postid}).Decode(&post)
+	if err != nil {
+		return false
+	}
+	if post.User_uuid != requester.User_uuid && !IsAdmin(requester) &&
+		(post.TeamID == "" || !CanEditTeam(db, requester, post.TeamID)) {
+		return false
+	}
+	_, err = db.Collection("RecruitmentPosts").UpdateOne(context.TODO(),
+		bson.M{"postid": postid}, bson.M{"$set": bson.M{"open": false}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// SearchRecruitmentPosts lists open posts, every non empty filter has to match
+func SearchRecruitmentPosts(db *mongo.Database, kind string, gameid string, role string, rank string, region string) []RecruitmentPost {
+	posts := []RecruitmentPost{}
+	filter := bson.M{"open": true}
+	for key, value := range map[string]string{
+		"kind": kind, "gameid": gameid, "role": role, "rank": rank, "region": region,
+	} {
+		if value != "" {
+			filter[key] = value
+		}
+	}
+	res, err := db.Collection("RecruitmentPosts").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.M{"createdat": -1}).SetLimit(100))
+	if err != nil {
+		log.Println(err)
+		return posts
+	}
+	for res.Next(context.TODO()) {
+		var post RecruitmentPost
+		res.Decode(&post)
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+// InviteToTeam lets a captain invite a player, usually one found on the board
+func InviteToTeam(db *mongo.Database, requester User, invite TeamInvite) bool {
+	if !CanEditTeam(db, requester, invite.TeamID) {
+		log.Println("Only the captain can invite to team " + invite.TeamID)
+		return false
+	}
+	if invite.User_uuid == "" && invite.PostID != "" {
+		var post RecruitmentPost
+		err := db.Collection("RecruitmentPosts").FindOne(context.TODO(),
+			bson.M{"postid": invite.PostID, "kind": "lft", "open": true}).Decode(&post)
+		if err != nil {
+			return false
+		}
+		invite.User_uuid = post.User_uuid
+	}
+	if invite.User_uuid == "" {
+		return false
+	}
+	pending, _ := db.Collection("TeamInvites").CountDocuments(context.TODO(),
+		bson.M{"teamid": invite.TeamID, "user_uuid": invite.User_uuid, "status": "pending"})
+	if pending > 0 {
+		return false
+	}
+	invite.InviteID = primitive.NewObjectID().Hex()
+	invite.InvitedBy = requester.User_uuid
+	invite.Status = "pending"
+	invite.CreatedAt = time.Now().UTC()
+	_, err := db.Collection("TeamInvites").InsertOne(context.TODO(), invite)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// RespondToInvite accepts or declines an invite, accepting joins the team
+// with the usual roster lock and game profile checks
+func RespondToInvite(db *mongo.Database, requester User, inviteid string, accept bool) bool {
+	var invite TeamInvite
+	err := db.Collection("TeamInvites").FindOne(context.TODO(),
+		bson.M{"inviteid": inviteid, "user_uuid": requester.User_uuid, "status": "pending"}).Decode(&invite)
+	if err != nil {
+		return false
+	}
+	if !accept {
+		res, err := db.Collection("TeamInvites").UpdateOne(context.TODO(),
+			bson.M{"inviteid": inviteid, "status": "pending"},
+			bson.M{"$set": bson.M{"status": "declined", "respondedat": time.Now().UTC()}})
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		return res.ModifiedCount == 1
+	}
+	// the invite is claimed before joining, so accepting it twice at once
+	// only joins the team once
+	res, err := db.Collection("TeamInvites").UpdateOne(context.TODO(),
+		bson.M{"inviteid": inviteid, "status": "pending"},
+		bson.M{"$set": bson.M{"status": "accepted", "respondedat": time.Now().UTC()}})
+	if err != nil || res.ModifiedCount == 0 {
+		return false
+	}
+	if !AddTeamMember(db, GetUserDetailsUUID(db, requester.User_uuid), invite.TeamID) {
+		db.Collection("TeamInvites").UpdateOne(context.TODO(),
+			bson.M{"inviteid": inviteid, "status": "accepted"},
+			bson.M{"$set": bson.M{"status": "pending"}, "$unset": bson.M{"respondedat": ""}})
+		return false
+	}
+	var team Team
+	db.Collection("Teams").FindOne(context.TODO(), bson.M{"teamid": invite.TeamID}).Decode(&team)
+	db.Collection("RecruitmentPosts").UpdateMany(context.TODO(),
+		bson.M{"kind": "lft", "user_uuid": requester.User_uuid, "gameid": team.GameID},
+		bson.M{"$set": bson.M{"open": false}})
+	db.Collection("RecruitmentPosts").UpdateMany(context.TODO(),
+		bson.M{"kind": "lfp", "teamid": invite.TeamID, "open": true},
+		bson.M{"$inc": bson.M{"slots": -1}})
+	db.Collection("RecruitmentPosts").UpdateMany(context.TODO(),
+		bson.M{"kind": "lfp", "teamid": invite.TeamID, "slots": bson.M{"$lt": 1}},
+		bson.M{"$set": bson.M{"open": false}})
+	return true
+}
+
+func GetInvites(db *mongo.Database, uuid string) []TeamInvite {
+	invites := []TeamInvite{}
+	res, err := db.Collection("TeamInvites").Find(context.TODO(),
+		bson.M{"user_uuid": uuid}, options.Find().SetSort(bson.M{"createdat": -1}))
+	if err != nil {
+		log.Println(err)
+		return invites
+	}
+	for res.Next(context.TODO()) {
+		var invite TeamInvite
+		res.Decode(&invite)
+		invites = append(invites, invite)
+	}
+	return invites
 }
 
 func AddGame(db *mongo.Database, gameInfo *Game) bool {
@@ -283,6 +764,41 @@ func addTransaction(db *mongo.Database, transactionInfo *Transaction) bool {
 	return status
 }
 
+func CreateNotification(db *mongo.Database, uuid string, message string) {
+	_, err := db.Collection("Notifications").InsertOne(context.TODO(), Notification{
+		NotificationID: primitive.NewObjectID().Hex(),
+		User_uuid:      uuid,
+		Message:        message,
+		CreatedAt:      time.Now().UTC(),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// notifyTeam notifies every member of the team
+func notifyTeam(db *mongo.Database, team Team, message string) {
+	for _, member := range team.UsersInTeam {
+		CreateNotification(db, member.User_uuid, message)
+	}
+}
+
+func GetNotifications(db *mongo.Database, uuid string) []Notification {
+	notifications := []Notification{}
+	res, err := db.Collection("Notifications").Find(context.TODO(), bson.M{"user_uuid": uuid},
+		options.Find().SetSort(bson.M{"createdat": -1}).SetLimit(100))
+	if err != nil {
+		log.Println(err)
+		return notifications
+	}
+	for res.Next(context.TODO()) {
+		var notification Notification
+		res.Decode(&notification)
+		notifications = append(notifications, notification)
+	}
+	return notifications
+}
+
 func addReference(db *mongo.Database, reference *Refer) bool {
 	status := true
 	_, err := db.Collection("ReferenceInfo").InsertOne(
@@ -300,6 +816,23 @@ func addReference(db *mongo.Database, reference *Refer) bool {
 
 func CreateTeams(db *mongo.Database, newTeam Team) bool {
 	status := true
+	if newTeam.TeamID == "" {
+		newTeam.TeamID = primitive.NewObjectID().Hex()
+	}
+	newTeam.Rating = 0
+	if IsTeamNameTaken(db, newTeam.GameID, newTeam.TeamName, newTeam.TeamID) {
+		log.Println("Team name " + newTeam.TeamName + " is taken for " + newTeam.GameID)
+		return false
+	}
+	if newTeam.CaptainID == "" && len(newTeam.UsersInTeam) > 0 {
+		newTeam.CaptainID = newTeam.UsersInTeam[0].User_uuid
+	}
+	for _, member := range newTeam.UsersInTeam {
+		if !HasGameProfile(db, member.User_uuid, newTeam.GameID) {
+			log.Println("User " + member.User_uuid + " has no profile for game " + newTeam.GameID)
+			return false
+		}
+	}
 	_, err := db.Collection("Teams").InsertOne(
 		context.TODO(), newTeam,
 	)
@@ -313,396 +846,6296 @@ func CreateTeams(db *mongo.Database, newTeam Team) bool {
 	return status
 }
 
-func GetTeamByName(db *mongo.Database, teamName string) []User {
-	res := db.Collection("Teams").FindOne(
-		context.TODO(), bson.M{"teamname": teamName},
-	)
-	var team Team
-	res.Decode(&team)
-	return team.UsersInTeam
-}
-
-func GetTeamsByGameID(db *mongo.Database, gameid string) []Team {
-	var teams []Team
-	res, err := db.Collection("Teams").Find(
-		context.TODO(), bson.M{"gameid": gameid},
-	)
-	if err != nil {
-		return nil
+// IsTeamNameTaken checks the name against other teams of the same game,
+// ignoring case
+func IsTeamNameTaken(db *mongo.Database, gameid string, teamName string, exceptTeamID string) bool {
+	if teamName == "" {
+		return true
 	}
-	for res.Next(context.TODO()) {
-		var team Team
-		res.Decode(&team)
-		teams = append(teams, team)
+	count, err := db.Collection("Teams").CountDocuments(context.TODO(),
+		bson.M{"gameid": gameid, "teamname": teamName, "teamid": bson.M{"$ne": exceptTeamID}},
+		options.Count().SetCollation(teamNameCollation))
+	if err != nil {
+		log.Println(err)
+		return true
 	}
-	return teams
+	return count > 0
 }
 
-func GetTeamsWhole(db *mongo.Database) []Team {
-	TeamsList := []Team{}
-	list, err := db.Collection("Teams").Find(
-		context.TODO(), bson.M{},
-	)
+// UpdateTeamProfile changes the public details of a team, the roster and
+// logo have their own endpoints
+func UpdateTeamProfile(db *mongo.Database, requester User, profile Team) bool {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": profile.TeamID}).Decode(&team)
 	if err != nil {
-		log.Printf(err.Error())
-	} else {
-		for list.Next(context.TODO()) {
-			var team Team
-			list.Decode(&team)
-			TeamsList = append(TeamsList, team)
-		}
+		log.Println(err)
+		return false
 	}
-	return TeamsList
-}
-
-func AddUserToTeam(db *mongo.Database, user string, team string) bool {
-	_, err := db.Collection("Teams").UpdateOne(context.TODO(),
-		bson.M{"teamid": team}, bson.M{"$push": bson.M{"usersinteam": user}})
+	if team.CaptainID != requester.User_uuid && !IsAdmin(requester) {
+		log.Println("Only the captain can edit team " + team.TeamID)
+		return false
+	}
+	if profile.TeamName == "" {
+		profile.TeamName = team.TeamName
+	}
+	if IsTeamNameTaken(db, team.GameID, profile.TeamName, team.TeamID) {
+		log.Println("Team name " + profile.TeamName + " is taken for " + team.GameID)
+		return false
+	}
+	team.TeamName = profile.TeamName
+	team.TeamTag = profile.TeamTag
+	team.Description = profile.Description
+	team.Country = profile.Country
+	team.SocialLinks = profile.SocialLinks
+	_, err = db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": team.TeamID},
+		bson.M{"$set": bson.M{
+			"teamname":    team.TeamName,
+			"teamtag":     team.TeamTag,
+			"description": team.Description,
+			"country":     team.Country,
+			"sociallinks": team.SocialLinks,
+		}})
 	if err != nil {
+		log.Println(err)
 		return false
 	}
+	syncTeamInTournaments(db, team)
 	return true
 }
 
-func RemoveUserFromTeam(db *mongo.Database, user string, team string) bool {
-	_, err := db.Collection("Teams").UpdateOne(context.TODO(),
-		bson.M{"teamid": team}, bson.M{"$pull": bson.M{"usersinteam": user}})
+// CanEditTeam reports whether the requester is the team's captain or an admin
+func CanEditTeam(db *mongo.Database, requester User, teamid string) bool {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": teamid}).Decode(&team)
 	if err != nil {
 		return false
 	}
-	return true
+	return team.CaptainID == requester.User_uuid || IsAdmin(requester)
 }
 
-func AddTournament(db *mongo.Database, tournament Tournaments) bool {
-	_, err := db.Collection("Tournaments").InsertOne(context.TODO(),
-		tournament)
+// SetTeamLogo points the team at a logo already saved under public/
+func SetTeamLogo(db *mongo.Database, requester User, teamid string, logo string) bool {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": teamid}).Decode(&team)
 	if err != nil {
+		log.Println(err)
 		return false
 	}
-	return true
-}
+	if !CanEditTeam(db, requester, teamid) {
+		log.Println("Only the captain can change the logo of team " + team.TeamID)
+		return false
+	}
+	team.Logo = logo
+	_, err = db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": teamid}, bson.M{"$set": bson.M{"logo": logo}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	syncTeamInTournaments(db, team)
+	return true
+}
 
-func AddStreamingLinksToTournament(db *mongo.Database, tournament string, steamLink StreamLink) bool {
-	_, err := db.Collection("Tournaments").UpdateOne(
-		context.TODO(), bson.M{"title": tournament},
-		bson.M{"$push": bson.M{"streamlinks": steamLink}},
+// GetTeamPage builds the public page of a team with its roster and the
+// tournaments it took part in
+func GetTeamPage(db *mongo.Database, teamid string) (TeamPage, bool) {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": teamid}).Decode(&team)
+	if err != nil {
+		return TeamPage{}, false
+	}
+	page := TeamPage{
+		TeamID:      team.TeamID,
+		TeamName:    team.TeamName,
+		TeamTag:     team.TeamTag,
+		TeamType:    team.TeamType,
+		GameID:      team.GameID,
+		Logo:        team.Logo,
+		Description: team.Description,
+		Country:     team.Country,
+		SocialLinks: team.SocialLinks,
+		CaptainID:   team.CaptainID,
+		Members:     []PublicMember{},
+		Tournaments: []TeamTournamentEntry{},
+	}
+	for _, member := range team.UsersInTeam {
+		user := GetUserDetailsUUID(db, member.User_uuid)
+		publicMember := PublicMember{
+			User_uuid:    member.User_uuid,
+			Fname:        user.Fname,
+			Lname:        user.Lname,
+			Country:      user.Country,
+			ProfileImage: user.ProfileImage,
+		}
+		for _, profile := range user.UsersGamesInformation {
+			if profile.GameID == team.GameID {
+				publicMember.IGN = profile.IGN
+				publicMember.Rank = profile.Rank
+			}
+		}
+		page.Members = append(page.Members, publicMember)
+	}
+
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{"$or": []bson.M{
+		{"teams.teamid": teamid},
+		{"rounds.groups.teams.teamid": teamid},
+	}})
+	if err != nil {
+		log.Println(err)
+		return page, true
+	}
+	for res.Next(context.TODO()) {
+		var tournament Tournaments
+		res.Decode(&tournament)
+		page.Tournaments = append(page.Tournaments, TeamTournamentEntry{
+			TournamentID:        tournament.TournamentID,
+			Slug:                tournament.Slug,
+			Title:               tournament.Title,
+			GameID:              tournament.GameID,
+			Banner:              tournament.Banner,
+			TournamentStartDate: tournament.TournamentStartDate,
+			TournamentEndDate:   tournament.TournamentEndDate,
+		})
+	}
+	return page, true
+}
+
+func GetTeamByID(db *mongo.Database, teamid string) (Team, bool) {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(), bson.M{"teamid": teamid}).Decode(&team)
+	if err != nil {
+		return Team{}, false
+	}
+	return team, true
+}
+
+func GetTeamByName(db *mongo.Database, teamName string) []User {
+	res := db.Collection("Teams").FindOne(
+		context.TODO(), bson.M{"teamname": teamName},
+	)
+	var team Team
+	res.Decode(&team)
+	return team.UsersInTeam
+}
+
+func GetTeamsByGameID(db *mongo.Database, gameid string) []Team {
+	var teams []Team
+	res, err := db.Collection("Teams").Find(
+		context.TODO(), bson.M{"gameid": gameid},
+	)
+	if err != nil {
+		return nil
+	}
+	for res.Next(context.TODO()) {
+		var team Team
+		res.Decode(&team)
+		teams = append(teams, team)
+	}
+	return teams
+}
+
+func GetTeamsWhole(db *mongo.Database) []Team {
+	TeamsList := []Team{}
+	list, err := db.Collection("Teams").Find(
+		context.TODO(), bson.M{},
 	)
+	if err != nil {
+		log.Printf(err.Error())
+	} else {
+		for list.Next(context.TODO()) {
+			var team Team
+			list.Decode(&team)
+			TeamsList = append(TeamsList, team)
+		}
+	}
+	return TeamsList
+}
+
+func AddUserToTeam(db *mongo.Database, user string, team string) bool {
+	if IsRosterLocked(db, team) {
+		log.Println("Roster of team " + team + " is locked")
+		return false
+	}
+	var teamTemp Team
+	db.Collection("Teams").FindOne(context.TODO(), bson.M{"teamid": team}).Decode(&teamTemp)
+	if !HasGameProfile(db, user, teamTemp.GameID) {
+		log.Println("User " + user + " has no profile for game " + teamTemp.GameID)
+		return false
+	}
+	_, err := db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": team}, bson.M{"$push": bson.M{"usersinteam": user}})
 	if err != nil {
 		return false
 	}
 	return true
 }
 
-func AddTeamToTournament(db *mongo.Database, tournament string, team Team) bool {
-	_, err := db.Collection("Tournaments").UpdateOne(
-		context.TODO(), bson.M{"title": tournament},
-		bson.M{"$push": bson.M{"teams": team}},
-	)
+func RemoveUserFromTeam(db *mongo.Database, user string, team string) bool {
+	if IsRosterLocked(db, team) {
+		log.Println("Roster of team " + team + " is locked")
+		return false
+	}
+	_, err := db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": team}, bson.M{"$pull": bson.M{"usersinteam": user}})
 	if err != nil {
 		return false
 	}
 	return true
 }
 
-func GetTournament(db *mongo.Database, tournament string) Tournaments {
-	res := db.Collection("Tournaments").FindOne(context.TODO(),
-		bson.M{"title": tournament})
-	var result Tournaments
-	res.Decode(&result)
-	return result
+// Authenticate looks the caller up by email and password
+func Authenticate(db *mongo.Database, creds Credentials) (User, bool) {
+	var user User
+	err := db.Collection("PersonalDetails").FindOne(context.TODO(),
+		bson.M{"email": creds.Email, "password": creds.Password}).Decode(&user)
+	if err != nil || creds.Email == "" {
+		return User{}, false
+	}
+	user.Password = ""
+	return user, true
 }
 
-func GetTournamentByGame(db *mongo.Database, gameid string) []Tournaments {
-	res, _ := db.Collection("Tournaments").Find(context.TODO(),
-		bson.M{"gameid": gameid})
-	tournamentsOfGame := []Tournaments{}
+func IsAdmin(user User) bool {
+	return user.Role == "admin"
+}
 
-	var result Tournaments
-	res.Decode(&result)
+func IsOrganizer(user User) bool {
+	return user.Role == "organizer" || IsAdmin(user)
+}
+
+// hasPassed is false for unset times
+func hasPassed(at time.Time, now time.Time) bool {
+	return !at.IsZero() && !now.Before(at)
+}
+
+// IsRosterLocked reports whether the team is registered in a tournament that
+// has started or whose rounds have been locked
+func IsRosterLocked(db *mongo.Database, teamid string) bool {
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{"$or": []bson.M{
+		{"teams.teamid": teamid},
+		{"rounds.groups.teams.teamid": teamid},
+	}})
+	if err != nil {
+		log.Println(err)
+		return true
+	}
+	now := time.Now()
 	for res.Next(context.TODO()) {
-		res.Decode(&result)
-		println(result.GameID)
-		tournamentsOfGame = append(tournamentsOfGame, result)
+		var tournament Tournaments
+		res.Decode(&tournament)
+		if hasPassed(tournament.TournamentStartDate, now) {
+			return true
+		}
+		for _, round := range tournament.Rounds {
+			if round.IsLocked {
+				return true
+			}
+			if hasPassed(round.LockAt, now) {
+				return true
+			}
+		}
 	}
-	return tournamentsOfGame
+	return false
 }
 
-func GetTournaments(db *mongo.Database) []Tournaments {
-	res, err := db.Collection("Tournaments").Find(context.TODO(),
-		bson.M{})
-	tournaments := []Tournaments{}
-	tempHolder := Tournaments{}
+// RequestSubstitution records a roster change for a locked team, it waits
+// for an admin before touching the roster
+func RequestSubstitution(db *mongo.Database, requester User, substitution Substitution) bool {
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": substitution.TeamID}).Decode(&team)
 	if err != nil {
-		return nil
+		log.Println(err)
+		return false
 	}
-	for res.Next(context.TODO()) {
-		res.Decode(&tempHolder)
-		tournaments = append(tournaments, tempHolder)
+	if team.CaptainID != requester.User_uuid && !IsAdmin(requester) {
+		log.Println("Only the captain can request a substitution for team " + team.TeamID)
+		return false
+	}
+	inTeam := false
+	for _, member := range team.UsersInTeam {
+		if member.User_uuid == substitution.OutUser {
+			inTeam = true
+		}
 	}
-	return tournaments
+	if !inTeam || substitution.InUser == "" {
+		return false
+	}
+
+	substitution.SubstitutionID = primitive.NewObjectID().Hex()
+	substitution.RequestedBy = requester.User_uuid
+	substitution.RequestedAt = time.Now().UTC()
+	substitution.Status = "pending"
+	substitution.ReviewedBy = ""
+	substitution.ReviewNote = ""
+	_, err = db.Collection("Substitutions").InsertOne(context.TODO(), substitution)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
 }
 
-func AddQualifierRoundInTournament(db *mongo.Database, tournament string, qualifier Rounds) bool {
-	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
-		bson.M{"title": tournament}, bson.M{"$push": bson.M{"rounds": qualifier}})
+// ReviewSubstitution lets an admin approve or reject a pending substitution,
+// approved ones are applied even though the roster is locked
+func ReviewSubstitution(db *mongo.Database, reviewer User, substitutionID string, approve bool, note string) bool {
+	if !IsAdmin(reviewer) {
+		log.Println("Only admins can review substitutions")
+		return false
+	}
+	var substitution Substitution
+	err := db.Collection("Substitutions").FindOne(context.TODO(),
+		bson.M{"substitutionid": substitutionID, "status": "pending"}).Decode(&substitution)
 	if err != nil {
+		log.Println(err)
 		return false
 	}
 
-	if res.ModifiedCount == 0 {
+	status := "rejected"
+	if approve {
+		if !applySubstitution(db, substitution) {
+			return false
+		}
+		status = "approved"
+	}
+	_, err = db.Collection("Substitutions").UpdateOne(context.TODO(),
+		bson.M{"substitutionid": substitutionID},
+		bson.M{"$set": bson.M{
+			"status":     status,
+			"reviewedby": reviewer.User_uuid,
+			"reviewedat": time.Now().UTC(),
+			"reviewnote": note,
+		}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+func applySubstitution(db *mongo.Database, substitution Substitution) bool {
+	incoming := GetUserDetailsUUID(db, substitution.InUser)
+	if incoming.User_uuid == "" {
+		log.Println("No user " + substitution.InUser)
+		return false
+	}
+	var team Team
+	err := db.Collection("Teams").FindOne(context.TODO(),
+		bson.M{"teamid": substitution.TeamID}).Decode(&team)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if !HasGameProfile(db, incoming.User_uuid, team.GameID) {
+		log.Println("User " + incoming.User_uuid + " has no profile for game " + team.GameID)
+		return false
+	}
+	if playerBannedForTeam(db, incoming.User_uuid, team.TeamID) {
+		log.Println("User " + incoming.User_uuid + " is disqualified from a tournament team " + team.TeamID + " plays in")
+		return false
+	}
+	if title, barred := memberIneligibleForTeam(db, team.TeamID, incoming); barred {
+		log.Println("User " + incoming.User_uuid + " is not eligible for " + title + " team " + team.TeamID + " is entered in")
+		return false
+	}
+	replaced := false
+	for i := 0; i < len(team.UsersInTeam); i++ {
+		if team.UsersInTeam[i].User_uuid == incoming.User_uuid {
+			log.Println("User " + incoming.User_uuid + " is already in team " + team.TeamID)
+			return false
+		}
+		if team.UsersInTeam[i].User_uuid == substitution.OutUser {
+			team.UsersInTeam[i] = rosterMember(incoming)
+			replaced = true
+		}
+	}
+	if !replaced {
+		log.Println("User " + substitution.OutUser + " is no longer in team " + team.TeamID)
+		return false
+	}
+	if team.CaptainID == substitution.OutUser {
+		team.CaptainID = incoming.User_uuid
+	}
+	// the roster has to still have the outgoing player and not the incoming
+	// one, or a change in between is overwritten
+	res, err := db.Collection("Teams").UpdateOne(context.TODO(),
+		bson.M{"teamid": team.TeamID, "usersinteam.user_uuid": bson.M{
+			"$all": []string{substitution.OutUser},
+			"$nin": []string{incoming.User_uuid},
+		}},
+		bson.M{"$set": bson.M{"usersinteam": team.UsersInTeam, "captainid": team.CaptainID}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if res.MatchedCount == 0 {
+		log.Println("Roster of team " + team.TeamID + " changed during the substitution")
 		return false
 	}
+	syncTeamInTournaments(db, team)
+	return true
+}
+
+// SetTeamRating sets the seeding strength snake seeding orders teams by
+func SetTeamRating(db *mongo.Database, organizer User, teamid string, rating int) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can rate teams")
+	}
+	var team Team
+	err := db.Collection("Teams").FindOneAndUpdate(context.TODO(),
+		bson.M{"teamid": teamid},
+		bson.M{"$set": bson.M{"rating": rating}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&team)
+	if err != nil {
+		return errors.New("no team " + teamid)
+	}
+	syncTeamInTournaments(db, team)
+	return nil
+}
+
+// syncTeamInTournaments refreshes the roster and profile of the team copies
+// embedded in tournaments and their groups
+func syncTeamInTournaments(db *mongo.Database, team Team) {
+	_, err := db.Collection("Tournaments").UpdateMany(context.TODO(),
+		bson.M{"teams.teamid": team.TeamID},
+		bson.M{"$set": bson.M{
+			"teams.$[t].teamname":    team.TeamName,
+			"teams.$[t].teamtag":     team.TeamTag,
+			"teams.$[t].logo":        team.Logo,
+			"teams.$[t].usersinteam": team.UsersInTeam,
+			"teams.$[t].captainid":   team.CaptainID,
+			"teams.$[t].rating":      team.Rating,
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"t.teamid": team.TeamID},
+		}}))
+	if err != nil {
+		log.Println(err)
+	}
+	_, err = db.Collection("Tournaments").UpdateMany(context.TODO(),
+		bson.M{"rounds.groups.teams.teamid": team.TeamID},
+		bson.M{"$set": bson.M{
+			"rounds.$[].groups.$[].teams.$[t].teamname":    team.TeamName,
+			"rounds.$[].groups.$[].teams.$[t].teamtag":     team.TeamTag,
+			"rounds.$[].groups.$[].teams.$[t].logo":        team.Logo,
+			"rounds.$[].groups.$[].teams.$[t].usersinteam": team.UsersInTeam,
+			"rounds.$[].groups.$[].teams.$[t].captainid":   team.CaptainID,
+			"rounds.$[].groups.$[].teams.$[t].rating":      team.Rating,
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"t.teamid": team.TeamID},
+		}}))
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func GetSubstitutions(db *mongo.Database, teamid string) []Substitution {
+	substitutions := []Substitution{}
+	res, err := db.Collection("Substitutions").Find(context.TODO(), bson.M{"teamid": teamid},
+		options.Find().SetSort(bson.M{"requestedat": -1}))
+	if err != nil {
+		log.Println(err)
+		return substitutions
+	}
+	for res.Next(context.TODO()) {
+		var substitution Substitution
+		res.Decode(&substitution)
+		substitutions = append(substitutions, substitution)
+	}
+	return substitutions
+}
+
+// tournamentSeason is the season a tournament counts towards in statistics
+func tournamentSeason(tournament Tournaments) string {
+	if tournament.Season != "" {
+		return tournament.Season
+	}
+	if !tournament.TournamentStartDate.IsZero() {
+		return strconv.Itoa(tournament.TournamentStartDate.In(TournamentLocation(tournament)).Year())
+	}
+	return "unknown"
+}
 
+// FinalizeTournamentResults stores the final standing of every team in a
+// tournament, sending them again replaces the earlier ones
+func FinalizeTournamentResults(db *mongo.Database, organizer User, tournamentID string, results []TournamentResult) bool {
+	if !IsOrganizer(organizer) {
+		log.Println("Only organizers can finalize results")
+		return false
+	}
+	var data Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": bson.M{"$in": []string{StatusLive, StatusCompleted}}}).Decode(&data)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	for _, result := range results {
+		if _, found := registeredTeam(data, result.TeamID); !found {
+			log.Println("Team " + result.TeamID + " is not registered in " + data.Title)
+			return false
+		}
+	}
+	for _, result := range results {
+		result.TournamentID = data.TournamentID
+		result.Title = data.Title
+		result.GameID = data.GameID
+		result.Season = tournamentSeason(data)
+		result.FinalizedBy = organizer.User_uuid
+		result.FinalizedAt = time.Now().UTC()
+		_, err := db.Collection("TournamentResults").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": result.TournamentID, "teamid": result.TeamID},
+			bson.M{"$set": result}, options.Update().SetUpsert(true))
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+	}
 	return true
 }
 
-func AddTeamInTournamentGroup(db *mongo.Database, tournament string, qualifier string, group Groups, team Team) Tournaments {
-	// key is concatenation of date and time
+func addToStatLine(line StatLine, result TournamentResult) StatLine {
+	line.Tournaments++
+	if result.Placement == 1 {
+		line.Wins++
+	}
+	// unplaced results count as entered but not towards placements
+	if result.Placement > 0 {
+		if line.BestPlacement == 0 || result.Placement < line.BestPlacement {
+			line.BestPlacement = result.Placement
+		}
+		totalPlacement := line.AveragePlacement * float64(line.Placed)
+		line.Placed++
+		line.AveragePlacement = (totalPlacement + float64(result.Placement)) / float64(line.Placed)
+	}
+	line.Kills += result.Kills
+	line.Points += result.Points
+	line.Winnings += result.Winnings
+	return line
+}
+
+// GetTeamStats aggregates a team's finalized results overall, per game and
+// per season
+func GetTeamStats(db *mongo.Database, teamid string) TeamStats {
+	stats := TeamStats{
+		TeamID:    teamid,
+		PerGame:   map[string]StatLine{},
+		PerSeason: map[string]StatLine{},
+		History:   []TournamentResult{},
+	}
+	res, err := db.Collection("TournamentResults").Find(context.TODO(),
+		bson.M{"teamid": teamid}, options.Find().SetSort(bson.M{"finalizedat": -1}))
+	if err != nil {
+		log.Println(err)
+		return stats
+	}
+	for res.Next(context.TODO()) {
+		var result TournamentResult
+		res.Decode(&result)
+		stats.History = append(stats.History, result)
+		stats.Overall = addToStatLine(stats.Overall, result)
+		stats.PerGame[result.GameID] = addToStatLine(stats.PerGame[result.GameID], result)
+		stats.PerSeason[result.Season] = addToStatLine(stats.PerSeason[result.Season], result)
+	}
+	return stats
+}
+
+var tournamentTransitions = map[string][]string{
+	StatusDraft:              {StatusPublished, StatusCancelled},
+	StatusPublished:          {StatusDraft, StatusRegistrationOpen, StatusCancelled},
+	StatusRegistrationOpen:   {StatusRegistrationClosed, StatusCancelled},
+	StatusRegistrationClosed: {StatusRegistrationOpen, StatusLive, StatusCancelled},
+	StatusLive:               {StatusCompleted, StatusCancelled},
+	StatusCompleted:          {},
+	StatusCancelled:          {},
+}
+
+func canTransition(from string, to string) bool {
+	for _, next := range tournamentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
 
-	res1 := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
+// TransitionTournament moves a tournament to a new status, the current status
+// is part of the filter so concurrent transitions cannot both win
+func TransitionTournament(db *mongo.Database, tournamentID string, to string) bool {
 	var data Tournaments
-	res1.Decode(&data)
-
-	for i := 0; i < len(data.Rounds); i++ {
-		if data.Rounds[i].QualifierName == qualifier {
-			println("found ")
-			currentRound := data.Rounds[i]
-			// Qualifier of focus
-			// ---------------------------------------------------
-			// check if the slot that user wants exists or not
-			foundSameSlot := false
-			for j := 0; j < len(currentRound.Groups); j++ {
-				if currentRound.Groups[j].StartingAtDate == group.StartingAtDate &&
-					currentRound.Groups[j].StartingAtTime == group.StartingAtTime {
-					foundSameSlot = true
-
-					// if exist then
-					if foundSameSlot {
-						// check if there is capacity
-						if len(data.Rounds[i].Groups[j].Teams) < data.Rounds[i].NumberOfTeamsPerGroup {
-							data.Rounds[i].Groups[j].Teams = append(data.Rounds[i].Groups[j].Teams, team)
-							// if has capacity then add in same slot
-							// write back to database
-							db.Collection("Tournaments").UpdateOne(context.TODO(),
-								bson.M{"rounds.qualifiername": data.Rounds[i].QualifierName},
-								bson.M{"$set": bson.M{"rounds.$.groups": data.Rounds[i].Groups}})
-							return Tournaments{}
-						} else {
-							println("CAPACITY / GROUP REACHED")
-							foundSameSlot = false
-							continue
-						}
-					}
-					break
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID}).Decode(&data)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if !canTransition(data.Status, to) {
+		log.Println("Tournament " + tournamentID + " cannot go from " + data.Status + " to " + to)
+		return false
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": data.Status},
+		bson.M{"$set": bson.M{"status": to}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return res.ModifiedCount == 1
+}
+
+// nextScheduledStatus is where the dates say the tournament should be now,
+// empty when it should stay put
+func nextScheduledStatus(tournament Tournaments, now time.Time) string {
+	switch tournament.Status {
+	case StatusPublished:
+		if hasPassed(tournament.RegistrationStartDate, now) {
+			return StatusRegistrationOpen
+		}
+	case StatusRegistrationOpen:
+		if hasPassed(tournament.RegistrationLastDate, now) {
+			return StatusRegistrationClosed
+		}
+	case StatusRegistrationClosed:
+		if hasPassed(tournament.TournamentStartDate, now) {
+			return StatusLive
+		}
+	case StatusLive:
+		if hasPassed(tournament.TournamentEndDate, now) {
+			return StatusCompleted
+		}
+	}
+	return ""
+}
+
+// AdvanceTournamentStatuses moves published and running tournaments along
+// as their dates pass
+func AdvanceTournamentStatuses(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{"status": bson.M{"$in": []string{
+		StatusPublished, StatusRegistrationOpen, StatusRegistrationClosed, StatusLive,
+	}}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	now := time.Now()
+	for res.Next(context.TODO()) {
+		var tournament Tournaments
+		res.Decode(&tournament)
+		for next := nextScheduledStatus(tournament, now); next != ""; next = nextScheduledStatus(tournament, now) {
+			if !TransitionTournament(db, tournament.TournamentID, next) {
+				break
+			}
+			log.Println("Tournament " + tournament.Title + " is now " + next)
+			tournament.Status = next
+		}
+	}
+}
+
+// RunSchedules runs the time driven jobs, main calls it every minute
+func RunSchedules(db *mongo.Database) {
+	AdvanceTournamentStatuses(db)
+	ProcessCheckIns(db)
+	StartScheduledMatches(db)
+	GenerateScrimLobbies(db)
+	SendScrimRooms(db)
+}
+
+// defaultTimeZone is used for tournaments that do not name their organizer's
+// time zone
+const defaultTimeZone = "Asia/Karachi"
+
+// TournamentLocation is the organizer's time zone
+func TournamentLocation(tournament Tournaments) *time.Location {
+	location, err := time.LoadLocation(tournament.TimeZone)
+	if err != nil || tournament.TimeZone == "" {
+		location, _ = time.LoadLocation(defaultTimeZone)
+	}
+	return location
+}
+
+// MigrateLegacyTournaments brings tournaments saved by older versions of the
+// server up to date
+func MigrateLegacyTournaments(db *mongo.Database) {
+	// tournaments from before the lifecycle were already public
+	_, err := db.Collection("Tournaments").UpdateMany(context.TODO(),
+		bson.M{"status": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"status": StatusPublished}})
+	if err != nil {
+		log.Println(err)
+	}
+	migrateLegacyDates(db)
+	migrateTournamentIDs(db)
+	migrateEligibleCountries(db)
+	migratePointTables(db)
+	migrateGroupResults(db)
+	migrateMatchStatuses(db)
+}
+
+// migrateGroupResults wraps the screenshots groups used to keep as plain
+// strings into pending submissions for an organizer to sort out
+func migrateGroupResults(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(),
+		bson.M{"rounds.groups.results": bson.M{"$type": "string"}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			TournamentID string
+			Rounds       []struct {
+				Groups []struct {
+					Results []interface{}
 				}
 			}
-			if !foundSameSlot {
-
-				if len(data.Rounds[i].Groups) < data.TotalTeams/data.Rounds[i].NumberOfTeamsPerGroup {
-					newGroupWithTeam := Groups{
-						GroupID:        "some random id",
-						MatchID:        "BGMI #1212",
-						StartingAtTime: group.StartingAtTime,
-						StartingAtDate: group.StartingAtDate,
-						Group:          "Group Name",
-						Teams:          []Team{team},
-						Results:        []string{},
-						RoomID:         "",
-						Password:       "",
-						Duration:       "45",
-						Rounds:         []Match{},
+		}
+		res.Decode(&legacy)
+		update := bson.M{}
+		for r, round := range legacy.Rounds {
+			for g, group := range round.Groups {
+				submissions := []interface{}{}
+				for _, result := range group.Results {
+					screenshot, ok := result.(string)
+					if !ok {
+						submissions = append(submissions, result)
+						continue
 					}
-					// here i add new group
-					db.Collection("Tournaments").UpdateOne(context.TODO(),
-						bson.M{"title": tournament, "rounds.qualifiername": qualifier},
-						bson.M{"$push": bson.M{"rounds.$.groups": newGroupWithTeam}})
-					foundSameSlot = false
-				} else {
-					println("No more teams")
+					submissions = append(submissions, ResultSubmission{
+						SubmissionID: primitive.NewObjectID().Hex(),
+						Screenshots:  []string{screenshot},
+						Status:       "pending",
+					})
 				}
+				update["rounds."+strconv.Itoa(r)+".groups."+strconv.Itoa(g)+".results"] = submissions
 			}
-			// else make a new one provided slot can be made
-
-			return data
-		}
-	}
-
-	return Tournaments{}
-	/*
-		// get all the tournaments to see the dates and time
-		res1 := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-		var data Tournaments
-		res1.Decode(&data)
-
-		// once got and save now check does the date and time that user is demainding is available pele se ya nai
-		for i := 0; i < len(data.Rounds); i++ {
-			tempRound := data.Rounds[i]
-
-			res11 := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-			var data2 Tournaments
-			res11.Decode(&data2)
-			println("----")
-			println(len(data2.Rounds[i].Groups))
-			println(data2.TotalTeams / data2.Rounds[i].NumberOfTeamsPerGroup)
-			println("----")
-			if len(data2.Rounds[i].Groups)-2 >= data2.TotalTeams/data2.Rounds[i].NumberOfTeamsPerGroup {
-				println("Limit reached cant create more groups")
-				return Tournaments{}
-			}
-
-			if tempRound.QualifierName == qualifier {
-				// println("found")
-				// great job now that you have found the qualifier you needed lets search for the slot we're looking for so we can add the user in there
-				// check of any group exist or not
-
-				// just in case if groups dont exist then for loop wont execute so I've to manually insert first time
-				if len(tempRound.Groups) == 0 {
-
-					println("================")
-					println("array was empty adding the first entry")
-					println("================")
-					newGroupWithTeam := Groups{
-						GroupID:        "some random id",
-						MatchID:        "BGMI #1212",
-						StartingAtTime: group.StartingAtTime,
-						StartingAtDate: group.StartingAtDate,
-						Group:          "Group Name",
-						Teams:          []Team{team},
-						Results:        []string{},
-						RoomID:         "",
-						Password:       "",
-						Duration:       "45",
-						Rounds:         []Match{},
-					}
-					// here i add new group
-					res2, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
-						bson.M{"title": tournament, "rounds.qualifiername": qualifier},
-						bson.M{"$push": bson.M{"rounds.$.groups": newGroupWithTeam}})
-
-					if err != nil {
-						return Tournaments{}
-					}
-
-					if res2.ModifiedCount == 0 {
-						return Tournaments{}
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": legacy.TournamentID},
+			bson.M{"$set": update})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// migrateMatchStatuses gives matches from before match scheduling an id and
+// a status, those with results were played. Their legacy date and time
+// strings become StartingAt.
+func migrateMatchStatuses(db *mongo.Database) {
+	exists := bson.M{"$exists": true}
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{"$or": []bson.M{
+		{"rounds.groups.rounds": bson.M{"$elemMatch": bson.M{"status": bson.M{"$in": []interface{}{nil, ""}}}}},
+		{"rounds.groups.rounds.date": exists},
+		{"rounds.groups.rounds.time": exists},
+	}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			TournamentID string
+			TimeZone     string
+			Rounds       []struct {
+				Groups []struct {
+					StartingAt time.Time
+					Rounds     []struct {
+						MatchID    string
+						Status     string
+						Date       string
+						Time       string
+						StartingAt time.Time
+						Results    []MatchResult
 					}
-					res1 = db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-					res1.Decode(&data)
-					return data
-				} else {
-					for j := 0; j < len(tempRound.Groups); j++ {
-						if tempRound.Groups[j].StartingAtTime == group.StartingAtTime &&
-							tempRound.Groups[j].StartingAtDate == group.StartingAtDate {
-							println("Group with same date time found")
-							// see if there is capacity in this group or not
-							// if teams joined in group are more than number of teams allowed per that group
-							// TODO this check doesnt work
-							println("Currently we have ")
-							println(len(tempRound.Groups[j].Teams))
-							if tempRound.NumberOfTeamsPerGroup > len(tempRound.Groups[j].Teams) {
-								println("Still has some capacity, adding slot")
-								tempRound.Groups[j].Teams = append(tempRound.Groups[j].Teams, team)
-
-								db.Collection("Tournaments").UpdateOne(context.TODO(),
-									bson.M{"rounds.qualifiername": tempRound.QualifierName}, bson.M{"$set": bson.M{"rounds.$.groups": tempRound.Groups}})
-
-								// adding a slot in the group
-								res1 = db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-								res1.Decode(&data)
-								return data
-							} else {
-								// println("Doesnt have any capacity making a new slot")
-
-								newGroupWithTeam := Groups{
-									GroupID:        "some random id",
-									MatchID:        "BGMI #1212",
-									StartingAtTime: group.StartingAtTime,
-									StartingAtDate: group.StartingAtDate,
-									Group:          "Group Name",
-									Teams:          []Team{team},
-									Results:        []string{},
-									RoomID:         "",
-									Password:       "",
-									Duration:       "45",
-									Rounds:         []Match{},
-								}
-								// here i add new group
-								res2, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
-									bson.M{"title": tournament, "rounds.qualifiername": qualifier}, bson.M{"$push": bson.M{"rounds.$.groups": newGroupWithTeam}})
-								if err != nil {
-									return Tournaments{}
-								}
-
-								if res2.ModifiedCount == 0 {
-									return Tournaments{}
-								}
-								// return by adding new team
-								res1 = db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-								res1.Decode(&data)
-								return data
-							}
-						} else {
-							// println("Group doesnt exist, making a new one")
-							// so add a new group for this team when no other group for the key is present
-							newGroupWithTeam := Groups{
-								GroupID:        "some random id",
-								MatchID:        "BGMI #1212",
-								StartingAtTime: group.StartingAtTime,
-								StartingAtDate: group.StartingAtDate,
-								Group:          "Group Name",
-								Teams:          []Team{team},
-								Results:        []string{},
-								RoomID:         "",
-								Password:       "",
-								Duration:       "45",
-								Rounds:         []Match{},
-							}
-							// here i add new group with team in it
-							res2, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
-								bson.M{"title": tournament, "rounds.qualifiername": qualifier}, bson.M{"$push": bson.M{"rounds.$.groups": newGroupWithTeam}})
-
-							if err != nil {
-								return Tournaments{}
-							}
-
-							if res2.ModifiedCount == 0 {
-								return Tournaments{}
-							}
-							// and return
-							res1 = db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-							res1.Decode(&data)
-							return data
+				}
+			}
+		}
+		if err := res.Decode(&legacy); err != nil {
+			log.Println(err)
+			continue
+		}
+		location := TournamentLocation(Tournaments{TimeZone: legacy.TimeZone})
+		set := bson.M{}
+		unset := bson.M{}
+		for r, round := range legacy.Rounds {
+			for g, group := range round.Groups {
+				for m, match := range group.Rounds {
+					matchPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g) + ".rounds." + strconv.Itoa(m)
+					if match.Date != "" || match.Time != "" {
+						// a time without a date is on the group's day
+						date := match.Date
+						if date == "" && !group.StartingAt.IsZero() {
+							date = group.StartingAt.In(location).Format("2/1/2006")
+						}
+						startingAt, ok := parseLegacyTime(date, match.Time, location)
+						switch {
+						case !ok:
+							log.Println("> Dropping unreadable match time \"" + match.Date + " " + match.Time + "\"")
+						case match.StartingAt.IsZero():
+							set[matchPath+".startingat"] = startingAt
+						}
+						unset[matchPath+".date"] = ""
+						unset[matchPath+".time"] = ""
+					}
+					if match.Status != "" {
+						continue
+					}
+					if match.MatchID == "" {
+						set[matchPath+".matchid"] = primitive.NewObjectID().Hex()
+					}
+					set[matchPath+".status"] = MatchScheduled
+					if len(match.Results) > 0 {
+						set[matchPath+".status"] = MatchCompleted
+					}
+				}
+			}
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			continue
+		}
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": legacy.TournamentID}, update)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// migratePointTables turns the old free text point tables into the default
+// scoring, keeping the text as the description
+func migratePointTables(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(),
+		bson.M{"pointtable": bson.M{"$type": "string"}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			TournamentID string
+			PointTable   string
+		}
+		res.Decode(&legacy)
+		table := DefaultPointTable()
+		table.Description = legacy.PointTable
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": legacy.TournamentID},
+			bson.M{"$set": bson.M{"pointtable": table}})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// migrateEligibleCountries replaces free text countries such as "Indian"
+// with ISO codes, unknown entries are dropped and logged
+func migrateEligibleCountries(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(),
+		bson.M{"eligibilitymode": bson.M{"$exists": false}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			TournamentID      string
+			EligibleCountries []string
+		}
+		res.Decode(&legacy)
+		codes := []string{}
+		unknown := []string{}
+		for _, country := range legacy.EligibleCountries {
+			if code, ok := NormalizeCountry(country); ok {
+				codes = append(codes, code)
+			} else {
+				// kept aside so the tournament does not become open to everyone
+				log.Println("> Unknown country \"" + country + "\" in " + legacy.TournamentID + " needs the organizer's attention")
+				unknown = append(unknown, country)
+			}
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": legacy.TournamentID},
+			bson.M{"$set": bson.M{"eligiblecountries": codes, "eligibilitymode": "allow", "unknowncountries": unknown}})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// migrateTournamentIDs gives tournaments created before IDs existed an ID
+// and a slug
+func migrateTournamentIDs(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(),
+		bson.M{"tournamentid": bson.M{"$in": []interface{}{nil, ""}}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Title string
+		}
+		res.Decode(&legacy)
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"_id": legacy.ID},
+			bson.M{"$set": bson.M{
+				"tournamentid": legacy.ID.Hex(),
+				"slug":         uniqueTournamentSlug(db, legacy.Title),
+			}})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// legacyTournamentDates holds the "26/2/2022" and "6:00" strings older
+// versions of the server saved instead of timestamps
+type legacyTournamentDates struct {
+	ID                    primitive.ObjectID `bson:"_id"`
+	TimeZone              string
+	RegistrationStartDate interface{}
+	RegistrationLastDate  interface{}
+	TournamentStartDate   interface{}
+	TournamentEndDate     interface{}
+	Rounds                []struct {
+		Dates  []string
+		Times  []string
+		LockAt interface{}
+		Groups []struct {
+			StartingAtDate string
+			StartingAtTime string
+			Rounds         []struct {
+				Date string
+				Time string
+			}
+		}
+	}
+}
+
+// parseLegacyTime reads a legacy date and optional time in the organizer's
+// time zone
+func parseLegacyTime(date string, clock string, location *time.Location) (time.Time, bool) {
+	value := strings.TrimSpace(date + " " + clock)
+	for _, layout := range []string{"2/1/2006 15:04", "2/1/2006"} {
+		parsed, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return parsed.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func migrateLegacyDates(db *mongo.Database) {
+	isString := bson.M{"$type": "string"}
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{"$or": []bson.M{
+		{"registrationstartdate": isString},
+		{"registrationlastdate": isString},
+		{"tournamentstartdate": isString},
+		{"tournamentenddate": isString},
+		{"rounds.dates": bson.M{"$exists": true}},
+		{"rounds.lockat": isString},
+		{"rounds.groups.startingatdate": bson.M{"$exists": true}},
+		{"rounds.groups.rounds.date": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var legacy legacyTournamentDates
+		if err := res.Decode(&legacy); err != nil {
+			log.Println(err)
+			continue
+		}
+		location := TournamentLocation(Tournaments{TimeZone: legacy.TimeZone})
+		set := bson.M{"timezone": location.String()}
+		unset := bson.M{}
+		convert := func(key string, value interface{}, wholeDay bool) {
+			text, ok := value.(string)
+			if !ok {
+				return
+			}
+			parsed, ok := parseLegacyTime(text, "", location)
+			if !ok {
+				log.Println("> Dropping unreadable " + key + " \"" + text + "\"")
+				unset[key] = ""
+				return
+			}
+			// the last registration and tournament days used to be inclusive
+			if wholeDay && !strings.Contains(text, ":") {
+				parsed = parsed.Add(24 * time.Hour)
+			}
+			set[key] = parsed
+		}
+		convert("registrationstartdate", legacy.RegistrationStartDate, false)
+		convert("registrationlastdate", legacy.RegistrationLastDate, true)
+		convert("tournamentstartdate", legacy.TournamentStartDate, false)
+		convert("tournamentenddate", legacy.TournamentEndDate, true)
+
+		for i, round := range legacy.Rounds {
+			prefix := "rounds." + strconv.Itoa(i) + "."
+			if round.Dates != nil || round.Times != nil {
+				slots := []time.Time{}
+				for k, date := range round.Dates {
+					clock := ""
+					if k < len(round.Times) {
+						clock = round.Times[k]
+					}
+					if slot, ok := parseLegacyTime(date, clock, location); ok {
+						slots = append(slots, slot)
+					}
+				}
+				set[prefix+"slots"] = slots
+				unset[prefix+"dates"] = ""
+				unset[prefix+"times"] = ""
+			}
+			convert(prefix+"lockat", round.LockAt, false)
+			for j, group := range round.Groups {
+				groupPrefix := prefix + "groups." + strconv.Itoa(j) + "."
+				if group.StartingAtDate != "" || group.StartingAtTime != "" {
+					if startingAt, ok := parseLegacyTime(group.StartingAtDate, group.StartingAtTime, location); ok {
+						set[groupPrefix+"startingat"] = startingAt
+					}
+					unset[groupPrefix+"startingatdate"] = ""
+					unset[groupPrefix+"startingattime"] = ""
+				}
+				for k, match := range group.Rounds {
+					matchPrefix := groupPrefix + "rounds." + strconv.Itoa(k) + "."
+					if match.Date != "" || match.Time != "" {
+						if startingAt, ok := parseLegacyTime(match.Date, match.Time, location); ok {
+							set[matchPrefix+"startingat"] = startingAt
 						}
+						unset[matchPrefix+"date"] = ""
+						unset[matchPrefix+"time"] = ""
 					}
 				}
 			}
+		}
+
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(), bson.M{"_id": legacy.ID}, update)
+		if err != nil {
+			log.Println(err)
+		} else {
+			log.Println("> Migrated dates of tournament " + legacy.ID.Hex())
+		}
+	}
+}
+
+// slugify turns a title into lower case words joined by dashes
+func slugify(title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if slug.Len() == 0 {
+		return "tournament"
+	}
+	return slug.String()
+}
+
+// uniqueTournamentSlug appends -2, -3 ... until the slug is free
+func uniqueTournamentSlug(db *mongo.Database, title string) string {
+	base := slugify(title)
+	slug := base
+	for n := 2; ; n++ {
+		count, err := db.Collection("Tournaments").CountDocuments(context.TODO(), bson.M{"slug": slug})
+		if err != nil || count == 0 {
+			return slug
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// IsTournamentTitleTaken checks the title against other tournaments of the
+// same game, ignoring case
+func IsTournamentTitleTaken(db *mongo.Database, gameid string, title string, exceptTournamentID string) bool {
+	count, err := db.Collection("Tournaments").CountDocuments(context.TODO(),
+		bson.M{"gameid": gameid, "title": title, "tournamentid": bson.M{"$ne": exceptTournamentID}},
+		options.Count().SetCollation(teamNameCollation))
+	if err != nil {
+		log.Println(err)
+		return true
+	}
+	return count > 0
+}
+
+// ResolveTournamentID accepts either a tournament ID or its slug
+func ResolveTournamentID(db *mongo.Database, key string) string {
+	var found struct {
+		TournamentID string
+	}
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"$or": []bson.M{{"tournamentid": key}, {"slug": key}}},
+		options.FindOne().SetProjection(bson.M{"tournamentid": 1})).Decode(&found)
+	if err != nil {
+		return ""
+	}
+	return found.TournamentID
+}
+
+// AddTournament saves a new tournament as a draft
+func AddTournament(db *mongo.Database, tournament *Tournaments) bool {
+	if tournament.Title == "" || IsTournamentTitleTaken(db, tournament.GameID, tournament.Title, "") {
+		log.Println("Tournament title " + tournament.Title + " is taken for " + tournament.GameID)
+		return false
+	}
+	// a new tournament goes through the lifecycle from the start, whatever
+	// registrations or groups the body carried
+	*tournament = blankTournament(*tournament)
+	tournament.TournamentID = primitive.NewObjectID().Hex()
+	tournament.Slug = uniqueTournamentSlug(db, tournament.Title)
+	tournament.Status = StatusDraft
+	if tournament.TimeZone == "" {
+		tournament.TimeZone = defaultTimeZone
+	}
+	if _, err := time.LoadLocation(tournament.TimeZone); err != nil {
+		log.Println("Unknown time zone " + tournament.TimeZone)
+		return false
+	}
+	if !normalizeEligibleCountries(tournament) {
+		return false
+	}
+	if !validPointTable(tournament.PointTable) {
+		log.Println("Invalid point table for " + tournament.Title)
+		return false
+	}
+	if !validPrizeSplit(tournament.PrizePool, tournament.PrizeSplit) {
+		log.Println("Invalid prize split for " + tournament.Title)
+		return false
+	}
+	if !validCheckIn(*tournament) {
+		log.Println("Invalid check-in settings for " + tournament.Title)
+		return false
+	}
+	_, err := db.Collection("Tournaments").InsertOne(context.TODO(),
+		tournament)
+	if err != nil {
+		return false
+	}
+	return true
+}
+
+func AddStreamingLinksToTournament(db *mongo.Database, organizer User, tournamentID string, steamLink StreamLink) bool {
+	if !IsOrganizer(organizer) {
+		return false
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(
+		context.TODO(), bson.M{"tournamentid": tournamentID, "status": bson.M{"$ne": StatusCancelled}},
+		bson.M{"$push": bson.M{"streamlinks": steamLink}},
+	)
+	if err != nil || res.MatchedCount == 0 {
+		return false
+	}
+	return true
+}
+
+// NormalizeCountry turns a code or free text country into its ISO 3166
+// alpha-2 code
+func NormalizeCountry(country string) (string, bool) {
+	value := strings.ToLower(strings.TrimSpace(country))
+	for code, names := range countryCodes {
+		if value == strings.ToLower(code) {
+			return code, true
+		}
+		for _, name := range names {
+			if value == name {
+				return code, true
+			}
+		}
+	}
+	return "", false
+}
+
+// EligibilityError lists the members keeping a team out of a tournament
+type EligibilityError struct {
+	Members []IneligibleMember
+}
+
+func (e *EligibilityError) Error() string {
+	names := []string{}
+	for _, member := range e.Members {
+		names = append(names, member.Name+" ("+member.Country+")")
+	}
+	return "not eligible for this tournament: " + strings.Join(names, ", ")
+}
+
+// IneligibleMembers checks every member's country against the tournament's
+// allow or deny list, members without a known country are never eligible
+// once a list is set
+func IneligibleMembers(db *mongo.Database, tournament Tournaments, team Team) []IneligibleMember {
+	ineligible := []IneligibleMember{}
+	if len(tournament.EligibleCountries) == 0 && len(tournament.UnknownCountries) == 0 {
+		return ineligible
+	}
+	listed := map[string]bool{}
+	for _, country := range tournament.EligibleCountries {
+		if code, ok := NormalizeCountry(country); ok {
+			listed[code] = true
+		}
+	}
+	for _, member := range team.UsersInTeam {
+		user := GetUserDetailsUUID(db, member.User_uuid)
+		code, known := NormalizeCountry(user.Country)
+		eligible := known && listed[code]
+		if tournament.EligibilityMode == "deny" {
+			eligible = known && !listed[code]
+		}
+		if !eligible {
+			ineligible = append(ineligible, IneligibleMember{
+				User_uuid: member.User_uuid,
+				Name:      strings.TrimSpace(user.Fname + " " + user.Lname),
+				Country:   user.Country,
+			})
+		}
+	}
+	return ineligible
+}
+
+// normalizeEligibleCountries rewrites the list as ISO codes, false when an
+// entry is not a known country
+func normalizeEligibleCountries(tournament *Tournaments) bool {
+	codes := []string{}
+	for _, country := range tournament.EligibleCountries {
+		code, ok := NormalizeCountry(country)
+		if !ok {
+			log.Println("Unknown country " + country)
+			return false
+		}
+		codes = append(codes, code)
+	}
+	tournament.EligibleCountries = codes
+	if tournament.EligibilityMode != "deny" {
+		tournament.EligibilityMode = "allow"
+	}
+	return true
+}
+
+// SetEligibility replaces a tournament's country list and mode before it
+// goes live, it clears the unknown entries left by the migration
+func SetEligibility(db *mongo.Database, organizer User, tournamentID string, countries []string, mode string) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can change eligibility")
+	}
+	if mode != "" && mode != "allow" && mode != "deny" {
+		return errors.New("eligibility mode is allow or deny")
+	}
+	tournament := Tournaments{EligibleCountries: countries, EligibilityMode: mode}
+	if !normalizeEligibleCountries(&tournament) {
+		return errors.New("the list has an unknown country")
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": bson.M{"$in": []string{
+			StatusDraft, StatusPublished, StatusRegistrationOpen, StatusRegistrationClosed,
+		}}},
+		bson.M{
+			"$set":   bson.M{"eligiblecountries": tournament.EligibleCountries, "eligibilitymode": tournament.EligibilityMode},
+			"$unset": bson.M{"unknowncountries": ""},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("tournament has already started")
+	}
+	return nil
+}
+
+// memberIneligibleForTeam is the first running tournament the team is
+// entered in whose country rules keep the user out, roster changes get the
+// same check as registration
+func memberIneligibleForTeam(db *mongo.Database, teamid string, user User) (string, bool) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{
+		"$or":    []bson.M{{"teams.teamid": teamid}, {"waitlist.teamid": teamid}},
+		"status": bson.M{"$nin": []string{StatusCompleted, StatusCancelled}},
+	})
+	if err != nil {
+		log.Println(err)
+		return "", true
+	}
+	for res.Next(context.TODO()) {
+		var tournament Tournaments
+		res.Decode(&tournament)
+		if len(IneligibleMembers(db, tournament, Team{UsersInTeam: []User{user}})) > 0 {
+			return tournament.Title, true
+		}
+	}
+	return "", false
+}
+
+// hasCapacity matches tournaments with room for another team, a TotalTeams
+// of zero means no limit
+var hasCapacity = bson.M{"$or": []bson.M{
+	{"totalteams": bson.M{"$lte": 0}},
+	{"$expr": bson.M{"$lt": []interface{}{
+		bson.M{"$size": bson.M{"$ifNull": []interface{}{"$teams", []interface{}{}}}},
+		"$totalteams",
+	}}},
+}}
+
+// AddTeamToTournament registers a team while registration is open, once the
+// tournament is full, or others are already waiting, the team is waitlisted.
+// It returns "registered" or "waitlisted".
+func AddTeamToTournament(db *mongo.Database, tournamentID string, team Team) (string, error) {
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID}).Decode(&tournament)
+	if err != nil {
+		return "", errors.New("no such tournament")
+	}
+	if err := registrationProblem(db, tournament, team); err != nil {
+		return "", err
+	}
+	notEntered := bson.M{
+		"tournamentid":    tournamentID,
+		"status":          StatusRegistrationOpen,
+		"teams.teamid":    bson.M{"$ne": team.TeamID},
+		"waitlist.teamid": bson.M{"$ne": team.TeamID},
+	}
+
+	// the capacity check is part of the filter so concurrent registrations
+	// cannot push past TotalTeams
+	filter := bson.M{"waitlist.0": bson.M{"$exists": false}}
+	for key, value := range notEntered {
+		filter[key] = value
+	}
+	for key, value := range hasCapacity {
+		filter[key] = value
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+		bson.M{"$push": bson.M{"teams": team}})
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	if res.ModifiedCount == 1 {
+		if !chargeEntranceFee(db, tournament, team) {
+			db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{"tournamentid": tournamentID},
+				bson.M{"$pull": bson.M{"teams": bson.M{"teamid": team.TeamID}}})
+			// the slot may have turned away a team that was waitlisted meanwhile
+			promoteFromWaitlist(db, tournamentID)
+			return "", errors.New("the captain cannot pay the entrance fee")
+		}
+		return "registered", nil
+	}
+
+	res, err = db.Collection("Tournaments").UpdateOne(context.TODO(), notEntered,
+		bson.M{"$push": bson.M{"waitlist": team}})
+	if err != nil || res.ModifiedCount == 0 {
+		return "", errors.New("registration is closed or the team is already entered")
+	}
+	// a slot may have opened between the two updates
+	promoteFromWaitlist(db, tournamentID)
+	return "waitlisted", nil
+}
+
+// registrationProblem is why the team may not take a place in the
+// tournament, nil when it may
+func registrationProblem(db *mongo.Database, tournament Tournaments, team Team) error {
+	if ineligible := IneligibleMembers(db, tournament, team); len(ineligible) > 0 {
+		return &EligibilityError{Members: ineligible}
+	}
+	for _, member := range team.UsersInTeam {
+		if IsDisqualified(db, tournament.TournamentID, "", member.User_uuid) {
+			return errors.New("player " + member.User_uuid + " is disqualified from this tournament")
+		}
+	}
+	if IsDisqualified(db, tournament.TournamentID, team.TeamID, "") {
+		return errors.New("team " + team.TeamID + " is disqualified from this tournament")
+	}
+	return nil
+}
+
+// WithdrawTeamFromTournament takes a team out of the tournament or its
+// waitlist before the tournament goes live. A registered team gets its
+// entrance fee back and its slot, and its group place, go to the waitlist.
+func WithdrawTeamFromTournament(db *mongo.Database, tournamentID string, teamid string) bool {
+	beforeLive := bson.M{"$in": []string{StatusRegistrationOpen, StatusRegistrationClosed}}
+	// the tournament as it was before the pull says what the team held, and
+	// only the request that pulled the entry refunds it
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOneAndUpdate(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": beforeLive, "teams.teamid": teamid},
+		bson.M{"$pull": bson.M{"teams": bson.M{"teamid": teamid}}}).Decode(&tournament)
+	if err == mongo.ErrNoDocuments {
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID, "status": beforeLive},
+			bson.M{"$pull": bson.M{"waitlist": bson.M{"teamid": teamid}}})
+		return err == nil && res.ModifiedCount == 1
+	}
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	team, _ := registeredTeam(tournament, teamid)
+	refundEntranceFee(db, tournament, team)
+
+	// seeding may already have placed the team once registration closed
+	r, g := -1, -1
+	for i, round := range tournament.Rounds {
+		for j, group := range round.Groups {
+			if r < 0 && groupHasTeam(group, teamid) {
+				r, g = i, j
+			}
+		}
+	}
+	if r >= 0 {
+		_, err = db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID, "rounds.groups.teams.teamid": teamid},
+			bson.M{
+				"$pull": bson.M{"rounds.$[].groups.$[].teams": bson.M{"teamid": teamid}},
+				"$inc":  bson.M{"rounds.$[].version": 1},
+			})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	promoted := promoteFromWaitlist(db, tournamentID)
+	replacement := ""
+	if len(promoted) > 0 {
+		replacement = promoted[0].TeamID
+		if r >= 0 {
+			takeFreedGroupPlace(db, tournament, r, g, promoted[0])
+		}
+	}
+	reseedWithout(db, tournamentID, teamid, replacement)
+	return true
+}
+
+// reseedWithout rebuilds the generated brackets and stages that hold a
+// withdrawn team, with the replacement in its seed, or without it when there
+// is none
+func reseedWithout(db *mongo.Database, tournamentID string, teamid string, replacement string) {
+	tournament := GetTournament(db, tournamentID)
+	for r, round := range tournament.Rounds {
+		roundPath := "rounds." + strconv.Itoa(r)
+		if round.Bracket != nil {
+			seeds := bracketSeeds(*round.Bracket)
+			if !containsString(seeds, teamid) || hasCompletedMatch(round.Bracket.Matches) {
+				continue
+			}
+			seeds = replaceSeed(seeds, teamid, replacement)
+			var bracket *Bracket
+			if built, err := BuildBracket(round.Bracket.Format, seeds); err == nil {
+				built.Version = round.Bracket.Version + 1
+				bracket = &built
+			}
+			_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{
+					"tournamentid":                 tournamentID,
+					roundPath + ".qualifiername":   round.QualifierName,
+					roundPath + ".bracket.version": versionIs(round.Bracket.Version),
+				},
+				bson.M{"$set": bson.M{roundPath + ".bracket": bracket}})
+			if err != nil {
+				log.Println(err)
+			}
+		}
+		if round.Stage != nil {
+			if !containsString(round.Stage.Seeds, teamid) || hasCompletedMatch(round.Stage.Matches) {
+				continue
+			}
+			seeds := replaceSeed(round.Stage.Seeds, teamid, replacement)
+			var stage *Stage
+			if built, err := BuildStage(round.Stage.Format, seeds, round.NumberOfTeamsPerGroup, round.SwissRounds, round.Slots); err == nil {
+				built.Version = round.Stage.Version + 1
+				stage = &built
+			}
+			_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{
+					"tournamentid":               tournamentID,
+					roundPath + ".qualifiername": round.QualifierName,
+					roundPath + ".stage.version": versionIs(round.Stage.Version),
+				},
+				bson.M{"$set": bson.M{roundPath + ".stage": stage}})
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// replaceSeed puts replacement in teamid's seed, or drops the seed when the
+// replacement is empty
+func replaceSeed(seeds []string, teamid string, replacement string) []string {
+	replaced := []string{}
+	for _, seed := range seeds {
+		if seed != teamid {
+			replaced = append(replaced, seed)
+		} else if replacement != "" && !containsString(seeds, replacement) {
+			replaced = append(replaced, replacement)
+		}
+	}
+	return replaced
+}
+
+func hasCompletedMatch(matches []HeadToHeadMatch) bool {
+	for _, match := range matches {
+		if match.Status == MatchCompleted {
+			return true
+		}
+	}
+	return false
+}
+
+// refundEntranceFee pays a withdrawn team's entrance fee back to the
+// captain it was taken from
+func refundEntranceFee(db *mongo.Database, tournament Tournaments, team Team) {
+	if tournament.Entrancefee <= 0 || team.CaptainID == "" {
+		return
+	}
+	captain := GetUserDetailsUUID(db, team.CaptainID)
+	res, err := db.Collection("PersonalDetails").UpdateOne(context.TODO(),
+		bson.M{"user_uuid": team.CaptainID},
+		bson.M{"$inc": bson.M{"userwallet.deposit_cash": tournament.Entrancefee}})
+	if err != nil || res.ModifiedCount == 0 {
+		log.Println("Could not refund the entrance fee of " + tournament.TournamentID + " to captain " + team.CaptainID)
+		return
+	}
+	addTransaction(db, &Transaction{
+		Transaction_id: primitive.NewObjectID().Hex(),
+		Wallet_id:      captain.UserWallet.Wallet_id,
+		Source:         "entrance fee refund " + tournament.TournamentID + " team " + team.TeamID,
+		Amount:         tournament.Entrancefee,
+		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+	})
+}
 
-			// GETTING THE INFORMATION
-			print("================================= Round ")
-			println(i)
-			resinfo := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-			var info Tournaments
-			resinfo.Decode(&info)
-			println("Tournament informations")
-			print("MAX teams ")
-			println(info.TotalTeams)
-			print("Total # groups currently formed for round are ")
-			println(len(info.Rounds[i].Groups))
-			println("Total # teams formed/group are ")
-			for a := 0; a < len(info.Rounds[i].Groups); a++ {
-				print("Group ")
-				print(a)
-				print(" has ")
-				print(len(info.Rounds[i].Groups[a].Teams))
-				println(" team(s)")
-			}
-			print("MAX number of group ")
-			println(info.TotalTeams / info.Rounds[i].NumberOfTeamsPerGroup)
-			println("=================================")
-		}
-
-		res1 = db.Collection("Tournaments").FindOne(context.TODO(), bson.M{"title": tournament, "rounds.qualifiername": qualifier})
-		res1.Decode(&data)
-		return data
-	*/
+// takeFreedGroupPlace puts a team promoted from the waitlist into the group
+// the withdrawn team left
+func takeFreedGroupPlace(db *mongo.Database, tournament Tournaments, r int, g int, team Team) {
+	roundPath := "rounds." + strconv.Itoa(r)
+	groupPath := roundPath + ".groups." + strconv.Itoa(g)
+	group := tournament.Rounds[r].Groups[g]
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":               tournament.TournamentID,
+			groupPath + ".groupid":       group.GroupID,
+			"rounds.groups.teams.teamid": bson.M{"$ne": team.TeamID},
+		},
+		bson.M{
+			"$push": bson.M{groupPath + ".teams": team},
+			"$inc":  bson.M{roundPath + ".version": 1},
+		})
+	if err != nil || res.ModifiedCount == 0 {
+		log.Println("Could not place team " + team.TeamID + " in " + group.Group + " of " + tournament.TournamentID)
+		return
+	}
+	notifyTeam(db, team, "Team "+team.TeamName+" plays in "+group.Group+" of "+tournament.Title)
+}
+
+// promoteFromWaitlist moves waitlisted teams into free slots, each promoted
+// team is charged and notified, teams that cannot pay lose their place.
+// It returns the teams that were promoted.
+func promoteFromWaitlist(db *mongo.Database, tournamentID string) []Team {
+	promoted := []Team{}
+	for {
+		var tournament Tournaments
+		err := db.Collection("Tournaments").FindOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID}).Decode(&tournament)
+		if err != nil || len(tournament.Waitlist) == 0 {
+			return promoted
+		}
+		next := tournament.Waitlist[0]
+		filter := bson.M{
+			"tournamentid":      tournamentID,
+			"waitlist.0.teamid": next.TeamID,
+			"status":            bson.M{"$in": []string{StatusRegistrationOpen, StatusRegistrationClosed}},
+		}
+		for key, value := range hasCapacity {
+			filter[key] = value
+		}
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+			bson.M{"$pop": bson.M{"waitlist": -1}, "$push": bson.M{"teams": next}})
+		if err != nil || res.ModifiedCount == 0 {
+			// full, or another request promoted the team first
+			return promoted
+		}
+		if !chargeEntranceFee(db, tournament, next) {
+			db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{"tournamentid": tournamentID},
+				bson.M{"$pull": bson.M{"teams": bson.M{"teamid": next.TeamID}}})
+			notifyTeam(db, next, "Team "+next.TeamName+" could not pay the entrance fee for "+
+				tournament.Title+" and left the waitlist")
+			continue
+		}
+		notifyTeam(db, next, "Team "+next.TeamName+" got a slot in "+tournament.Title)
+		promoted = append(promoted, next)
+	}
+}
+
+// chargeEntranceFee takes the fee from the captain's deposit cash
+func chargeEntranceFee(db *mongo.Database, tournament Tournaments, team Team) bool {
+	if tournament.Entrancefee <= 0 {
+		return true
+	}
+	captain := GetUserDetailsUUID(db, team.CaptainID)
+	res, err := db.Collection("PersonalDetails").UpdateOne(context.TODO(),
+		bson.M{"user_uuid": team.CaptainID, "userwallet.deposit_cash": bson.M{"$gte": tournament.Entrancefee}},
+		bson.M{"$inc": bson.M{"userwallet.deposit_cash": -tournament.Entrancefee}})
+	if err != nil || res.ModifiedCount == 0 {
+		log.Println("Captain " + team.CaptainID + " cannot pay the entrance fee of " + tournament.TournamentID)
+		return false
+	}
+	addTransaction(db, &Transaction{
+		Transaction_id: primitive.NewObjectID().Hex(),
+		Wallet_id:      captain.UserWallet.Wallet_id,
+		Source:         "entrance fee " + tournament.TournamentID + " team " + team.TeamID,
+		Amount:         -tournament.Entrancefee,
+		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+	})
+	return true
+}
+
+func GetTournament(db *mongo.Database, tournamentID string) Tournaments {
+	res := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID})
+	var result Tournaments
+	res.Decode(&result)
+	return result
+}
+
+// GetTournamentByGame lists the summaries of a game's tournaments
+func GetTournamentByGame(db *mongo.Database, gameid string) []TournamentSummary {
+	res, err := db.Collection("Tournaments").Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"gameid": gameid, "status": bson.M{"$ne": StatusDraft}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "tournamentstartdate", Value: 1}, {Key: "tournamentid", Value: 1}}}},
+		{{Key: "$project", Value: tournamentSummaryFields}},
+	})
+	tournamentsOfGame := []TournamentSummary{}
+	if err != nil {
+		log.Println(err)
+		return tournamentsOfGame
+	}
+	for res.Next(context.TODO()) {
+		var result TournamentSummary
+		res.Decode(&result)
+		tournamentsOfGame = append(tournamentsOfGame, result)
+	}
+	return tournamentsOfGame
+}
+
+// tournamentSummaryFields projects a tournament down to a TournamentSummary
+var tournamentSummaryFields = bson.M{
+	"tournamentid":          1,
+	"slug":                  1,
+	"banner":                1,
+	"title":                 1,
+	"gameid":                1,
+	"sponsor":               1,
+	"entrancefee":           1,
+	"registrationstartdate": 1,
+	"registrationlastdate":  1,
+	"tournamentstartdate":   1,
+	"tournamentenddate":     1,
+	"timezone":              1,
+	"tournamentsteamtype":   1,
+	"eligiblecountries":     1,
+	"eligibilitymode":       1,
+	"totalteams":            1,
+	"registeredteams":       bson.M{"$size": bson.M{"$ifNull": []interface{}{"$teams", []interface{}{}}}},
+	"prizepool":             1,
+	"tier":                  1,
+	"season":                1,
+	"status":                1,
+}
+
+// tournamentSortFields are the orders a listing can take
+var tournamentSortFields = map[string]string{
+	"start":        "tournamentstartdate",
+	"registration": "registrationlastdate",
+	"fee":          "entrancefee",
+	"prize":        "prizepool",
+}
+
+const (
+	defaultTournamentPage = 20
+	maxTournamentPage     = 100
+)
+
+// sortValue is the value a summary is ordered by, dates as milliseconds
+func sortValue(summary TournamentSummary, field string) int64 {
+	switch field {
+	case "registrationlastdate":
+		return summary.RegistrationLastDate.UnixMilli()
+	case "entrancefee":
+		return int64(summary.Entrancefee)
+	case "prizepool":
+		return int64(summary.PrizePool)
+	}
+	return summary.TournamentStartDate.UnixMilli()
+}
+
+// encodeCursor and decodeCursor carry the last tournament of a page so the
+// next page starts right after it, whatever was added in between
+func encodeCursor(value int64, tournamentID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(value, 10) + "|" + tournamentID))
+}
+
+func decodeCursor(cursor string, field string) (interface{}, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, "", errors.New("invalid cursor")
+	}
+	value, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, "", errors.New("invalid cursor")
+	}
+	if field == "entrancefee" || field == "prizepool" {
+		return int(value), parts[1], nil
+	}
+	return time.UnixMilli(value).UTC(), parts[1], nil
+}
+
+// SearchTournaments lists tournament summaries page by page, drafts only
+// show up when an organizer asks for them by status. Anonymous searches pass
+// an empty viewer.
+func SearchTournaments(db *mongo.Database, viewer User, search TournamentSearch) (TournamentPage, error) {
+	if containsString(search.Statuses, StatusDraft) && !IsOrganizer(viewer) {
+		return TournamentPage{}, errors.New("only organizers can list drafts")
+	}
+	conditions := []bson.M{}
+	if search.GameID != "" {
+		conditions = append(conditions, bson.M{"gameid": search.GameID})
+	}
+	if len(search.Statuses) > 0 {
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": search.Statuses}})
+	} else {
+		conditions = append(conditions, bson.M{"status": bson.M{"$ne": StatusDraft}})
+	}
+	if search.Tier != "" {
+		conditions = append(conditions, bson.M{"tier": search.Tier})
+	}
+	if search.TeamType != "" {
+		conditions = append(conditions, bson.M{"tournamentsteamtype": search.TeamType})
+	}
+	if search.Country != "" {
+		code, ok := NormalizeCountry(search.Country)
+		if !ok {
+			return TournamentPage{}, errors.New("unknown country " + search.Country)
+		}
+		// the same rule IneligibleMembers applies at registration
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"eligiblecountries.0": bson.M{"$exists": false}, "unknowncountries.0": bson.M{"$exists": false}},
+			{"eligibilitymode": bson.M{"$ne": "deny"}, "eligiblecountries": code},
+			{"eligibilitymode": "deny", "eligiblecountries": bson.M{"$ne": code}},
+		}})
+	}
+	if !search.StartsAfter.IsZero() {
+		conditions = append(conditions, bson.M{"tournamentstartdate": bson.M{"$gte": search.StartsAfter}})
+	}
+	if !search.StartsBefore.IsZero() {
+		conditions = append(conditions, bson.M{"tournamentstartdate": bson.M{"$lte": search.StartsBefore}})
+	}
+	if search.MinFee > 0 {
+		conditions = append(conditions, bson.M{"entrancefee": bson.M{"$gte": search.MinFee}})
+	}
+	if search.MaxFee >= 0 {
+		conditions = append(conditions, bson.M{"entrancefee": bson.M{"$lte": search.MaxFee}})
+	}
+
+	order := 1
+	sortBy := search.Sort
+	if strings.HasPrefix(sortBy, "-") {
+		order = -1
+		sortBy = sortBy[1:]
+	}
+	if sortBy == "" {
+		sortBy = "start"
+	}
+	field, ok := tournamentSortFields[sortBy]
+	if !ok {
+		return TournamentPage{}, errors.New("cannot sort by " + search.Sort)
+	}
+	if search.Cursor != "" {
+		value, tournamentID, err := decodeCursor(search.Cursor, field)
+		if err != nil {
+			return TournamentPage{}, err
+		}
+		after := "$gt"
+		if order < 0 {
+			after = "$lt"
+		}
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{field: bson.M{after: value}},
+			{field: value, "tournamentid": bson.M{after: tournamentID}},
+		}})
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = defaultTournamentPage
+	}
+	if limit > maxTournamentPage {
+		limit = maxTournamentPage
+	}
+
+	// one more than the page tells whether there is a next one
+	res, err := db.Collection("Tournaments").Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": conditions}}},
+		{{Key: "$sort", Value: bson.D{{Key: field, Value: order}, {Key: "tournamentid", Value: order}}}},
+		{{Key: "$limit", Value: limit + 1}},
+		{{Key: "$project", Value: tournamentSummaryFields}},
+	})
+	if err != nil {
+		return TournamentPage{}, err
+	}
+	page := TournamentPage{Tournaments: []TournamentSummary{}}
+	for res.Next(context.TODO()) {
+		var summary TournamentSummary
+		res.Decode(&summary)
+		page.Tournaments = append(page.Tournaments, summary)
+	}
+	if len(page.Tournaments) > limit {
+		page.Tournaments = page.Tournaments[:limit]
+		last := page.Tournaments[limit-1]
+		page.NextCursor = encodeCursor(sortValue(last, field), last.TournamentID)
+	}
+	return page, nil
+}
+
+// AddQualifierRoundInTournament appends a round with the given settings to a
+// tournament that has not started
+func AddQualifierRoundInTournament(db *mongo.Database, organizer User, tournamentID string, qualifier Rounds) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can add rounds")
+	}
+	if qualifier.QualifierName == "" {
+		return errors.New("a round needs a qualifier name")
+	}
+	if qualifier.NumberOfTeamsPerGroup <= 0 {
+		return errors.New("a round needs at least one team per group")
+	}
+	switch qualifier.Format {
+	case "", FormatBattleRoyale, FormatSingleElimination, FormatDoubleElimination, FormatSwiss, FormatRoundRobin:
+	default:
+		return errors.New("unknown round format " + qualifier.Format)
+	}
+	// only the round's settings are taken, groups, brackets, stages and
+	// qualifiers are made by the server as the round is played
+	round := Rounds{
+		QualifierName:                 qualifier.QualifierName,
+		Slots:                         qualifier.Slots,
+		Groups:                        []Groups{},
+		NumOfQualifyingTeamsThisRound: qualifier.NumOfQualifyingTeamsThisRound,
+		MapName:                       qualifier.MapName,
+		LockAt:                        qualifier.LockAt,
+		NumberOfTeamsPerGroup:         qualifier.NumberOfTeamsPerGroup,
+		Format:                        qualifier.Format,
+		SwissRounds:                   qualifier.SwissRounds,
+		MatchTemplate:                 qualifier.MatchTemplate,
+	}
+	if round.Slots == nil {
+		round.Slots = []time.Time{}
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":         tournamentID,
+			"rounds.qualifiername": bson.M{"$ne": round.QualifierName},
+			"status": bson.M{"$in": []string{
+				StatusDraft, StatusPublished, StatusRegistrationOpen, StatusRegistrationClosed,
+			}},
+		}, bson.M{"$push": bson.M{"rounds": round}})
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return errors.New("the tournament has started or already has a round " + round.QualifierName)
+	}
+	return nil
+}
+
+// Seeding strategies for SeedRound
+const (
+	SeedRandom     = "random"
+	SeedSnake      = "snake"
+	SeedRegion     = "region"
+	SeedPreference = "preference"
+	SeedRanked     = "ranked" // snake in the order given, used between rounds
+)
+
+// dealIntoGroups hands the teams out one per group in turn
+func dealIntoGroups(teams []Team, groups []Groups) {
+	for i, team := range teams {
+		g := i % len(groups)
+		groups[g].Teams = append(groups[g].Teams, team)
+	}
+}
+
+// snakeIntoGroups deals the first row left to right, the next right to left,
+// so strong teams are spread evenly
+func snakeIntoGroups(teams []Team, groups []Groups) {
+	for i, team := range teams {
+		row, column := i/len(groups), i%len(groups)
+		if row%2 == 1 {
+			column = len(groups) - 1 - column
+		}
+		groups[column].Teams = append(groups[column].Teams, team)
+	}
+}
+
+// orderByRegion lists the teams country by country, the biggest countries
+// first, so dealing them out spreads every country across the groups
+func orderByRegion(teams []Team) []Team {
+	byRegion := map[string][]Team{}
+	regions := []string{}
+	for _, team := range teams {
+		// "PK", "pk" and "Pakistan" are one region
+		region := strings.ToLower(strings.TrimSpace(team.Country))
+		if code, ok := NormalizeCountry(team.Country); ok {
+			region = code
+		}
+		if _, seen := byRegion[region]; !seen {
+			regions = append(regions, region)
+		}
+		byRegion[region] = append(byRegion[region], team)
+	}
+	sort.SliceStable(regions, func(a, b int) bool {
+		return len(byRegion[regions[a]]) > len(byRegion[regions[b]])
+	})
+	ordered := []Team{}
+	for _, region := range regions {
+		ordered = append(ordered, byRegion[region]...)
+	}
+	return ordered
+}
+
+// placeByPreference gives each team the first preferred slot with room,
+// teams whose preferences are full go to the emptiest group
+func placeByPreference(teams []Team, groups []Groups, perGroup int) {
+	for _, team := range teams {
+		placed := false
+		for _, preferred := range team.SlotPreferences {
+			for g := range groups {
+				if groups[g].StartingAt.Equal(preferred) && len(groups[g].Teams) < perGroup {
+					groups[g].Teams = append(groups[g].Teams, team)
+					placed = true
+					break
+				}
+			}
+			if placed {
+				break
+			}
+		}
+		if !placed {
+			emptiest := 0
+			for g := range groups {
+				if len(groups[g].Teams) < len(groups[emptiest].Teams) {
+					emptiest = g
+				}
+			}
+			groups[emptiest].Teams = append(groups[emptiest].Teams, team)
+		}
+	}
+}
+
+// BuildSeededGroups splits the teams into groups of at most perGroup using
+// the strategy, groups take the round's slots in turn
+func BuildSeededGroups(teams []Team, perGroup int, slots []time.Time, duration string, strategy string) ([]Groups, error) {
+	if perGroup <= 0 {
+		return nil, errors.New("round has no group size")
+	}
+	if duration == "" {
+		duration = defaultGroupDuration
+	}
+	count := (len(teams) + perGroup - 1) / perGroup
+	groups := make([]Groups, count)
+	for g := range groups {
+		groups[g] = Groups{
+			GroupID:  primitive.NewObjectID().Hex(),
+			Group:    groupName(g),
+			Teams:    []Team{},
+			Rounds:   []Match{},
+			Results:  []ResultSubmission{},
+			Duration: duration,
+		}
+		if len(slots) > 0 {
+			groups[g].StartingAt = slots[g%len(slots)]
+		}
+	}
+	if count == 0 {
+		return groups, nil
+	}
+
+	ordered := append([]Team{}, teams...)
+	switch strategy {
+	case SeedRandom:
+		rand.Shuffle(len(ordered), func(a, b int) { ordered[a], ordered[b] = ordered[b], ordered[a] })
+		dealIntoGroups(ordered, groups)
+	case SeedSnake:
+		sort.SliceStable(ordered, func(a, b int) bool { return ordered[a].Rating > ordered[b].Rating })
+		snakeIntoGroups(ordered, groups)
+	case SeedRegion:
+		rand.Shuffle(len(ordered), func(a, b int) { ordered[a], ordered[b] = ordered[b], ordered[a] })
+		dealIntoGroups(orderByRegion(ordered), groups)
+	case SeedPreference:
+		placeByPreference(ordered, groups, perGroup)
+	case SeedRanked:
+		snakeIntoGroups(ordered, groups)
+	default:
+		return nil, errors.New("unknown seeding strategy " + strategy)
+	}
+	return groups, nil
+}
+
+// SeedRound replaces the groups of a round with its teams seeded by the
+// strategy, every registered team in the first round and the previous
+// round's qualifiers after it
+func SeedRound(db *mongo.Database, organizer User, tournamentID string, qualifier string, strategy string) ([]Groups, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can seed rounds")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": tournamentID,
+		"status":       bson.M{"$in": []string{StatusRegistrationClosed, StatusLive}},
+	}).Decode(&tournament)
+	if err != nil {
+		return nil, errors.New("tournament is not ready for seeding")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return nil, errors.New("no round " + qualifier)
+	}
+	round := tournament.Rounds[r]
+	if round.IsLocked || hasPassed(round.LockAt, time.Now()) {
+		return nil, errors.New("round " + qualifier + " is locked")
+	}
+	now := time.Now()
+	for _, group := range round.Groups {
+		if hasPassed(group.StartingAt, now) || len(group.Standings) > 0 || len(group.Results) > 0 {
+			return nil, errors.New(group.Group + " has started, round " + qualifier + " cannot be seeded again")
+		}
+		for _, match := range group.Rounds {
+			if len(match.Results) > 0 || match.Status == MatchLive {
+				return nil, errors.New(group.Group + " has started, round " + qualifier + " cannot be seeded again")
+			}
+		}
+	}
+	teams := tournament.Teams
+	if r > 0 {
+		previous := tournament.Rounds[r-1]
+		if previous.QualifiedTeams == nil {
+			return nil, errors.New("round " + previous.QualifierName + " has not completed")
+		}
+		teams = []Team{}
+		for _, teamid := range previous.QualifiedTeams {
+			if team, ok := registeredTeam(tournament, teamid); ok {
+				teams = append(teams, team)
+			}
+		}
+	}
+	groups, err := BuildSeededGroups(teams, round.NumberOfTeamsPerGroup, round.Slots, "", strategy)
+	if err != nil {
+		return nil, err
+	}
+	roundPath := "rounds." + strconv.Itoa(r)
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		// the groups have to be the version checked, so teams that joined
+		// or results entered meanwhile are not thrown away
+		bson.M{
+			"tournamentid":               tournamentID,
+			roundPath + ".qualifiername": qualifier,
+			roundPath + ".islocked":      bson.M{"$ne": true},
+			roundPath + ".version":       versionIs(round.Version),
+		},
+		bson.M{
+			"$set": bson.M{roundPath + ".groups": groups},
+			"$inc": bson.M{roundPath + ".version": 1},
+		})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("round " + qualifier + " changed, try again")
+	}
+	return groups, nil
+}
+
+// SetSlotPreferences records which of the round slots a registered team
+// would like to play in, best first
+func SetSlotPreferences(db *mongo.Database, tournamentID string, teamid string, slots []time.Time) bool {
+	offered := map[int64]bool{}
+	for _, round := range GetTournament(db, tournamentID).Rounds {
+		for _, slot := range round.Slots {
+			offered[slot.Unix()] = true
+		}
+	}
+	for _, slot := range slots {
+		if !offered[slot.Unix()] {
+			log.Println("Slot " + slot.Format(time.RFC3339) + " is not offered in " + tournamentID)
+			return false
+		}
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid": tournamentID,
+			"teams.teamid": teamid,
+			"status":       bson.M{"$in": []string{StatusRegistrationOpen, StatusRegistrationClosed}},
+		},
+		bson.M{"$set": bson.M{"teams.$.slotpreferences": slots}})
+	if err != nil || res.MatchedCount == 0 {
+		return false
+	}
+	return true
+}
+
+// placementRank treats a missing placement as the worst one
+func placementRank(placement int) int {
+	if placement <= 0 {
+		return math.MaxInt32
+	}
+	return placement
+}
+
+// defaultTieBreakers settle level points on kills, then the best placement
+// and then the placement in the last match
+var defaultTieBreakers = []string{TieBreakKills, TieBreakBestPlacement, TieBreakLastPlacement}
+
+// standingBeforeBy puts disqualified teams last and orders the rest by
+// points, then the tie breakers in turn and finally the teamid so the order
+// never depends on the input
+func standingBeforeBy(a Standing, b Standing, tieBreakers []string) bool {
+	if a.Disqualified != b.Disqualified {
+		return !a.Disqualified
+	}
+	if a.Points != b.Points {
+		return a.Points > b.Points
+	}
+	for _, tieBreaker := range tieBreakers {
+		switch tieBreaker {
+		case TieBreakKills:
+			if a.Kills != b.Kills {
+				return a.Kills > b.Kills
+			}
+		case TieBreakBestPlacement:
+			if placementRank(a.BestPlacement) != placementRank(b.BestPlacement) {
+				return placementRank(a.BestPlacement) < placementRank(b.BestPlacement)
+			}
+		case TieBreakLastPlacement:
+			if placementRank(a.LastPlacement) != placementRank(b.LastPlacement) {
+				return placementRank(a.LastPlacement) < placementRank(b.LastPlacement)
+			}
+		}
+	}
+	return a.TeamID < b.TeamID
+}
+
+// RankStandings sorts the table and numbers the ranks from 1
+func RankStandings(standings []Standing) []Standing {
+	return rankStandingsBy(standings, defaultTieBreakers)
+}
+
+func rankStandingsBy(standings []Standing, tieBreakers []string) []Standing {
+	sort.SliceStable(standings, func(a, b int) bool {
+		return standingBeforeBy(standings[a], standings[b], tieBreakers)
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+	return standings
+}
+
+// groupTable is the group's ranked standings with a zero line for teams
+// that have none yet
+func groupTable(group Groups, tieBreakers []string) []Standing {
+	table := []Standing{}
+	seen := map[string]bool{}
+	for _, standing := range group.Standings {
+		table = append(table, standing)
+		seen[standing.TeamID] = true
+	}
+	for _, team := range group.Teams {
+		if !seen[team.TeamID] {
+			table = append(table, Standing{TeamID: team.TeamID, TeamName: team.TeamName})
+		}
+	}
+	return rankStandingsBy(table, tieBreakers)
+}
+
+// DefaultPointTable is the usual battle royale scoring, 15 points for a win
+// down to 1 for 12th and a point a kill
+func DefaultPointTable() PointTable {
+	return PointTable{
+		PlacementPoints: []int{15, 12, 10, 8, 6, 4, 2, 1, 1, 1, 1, 1},
+		KillPoints:      1,
+		TieBreakers:     defaultTieBreakers,
+	}
+}
+
+// scoringFor is the tournament's point table with the defaults filled in
+func scoringFor(tournament Tournaments) PointTable {
+	table := tournament.PointTable
+	if len(table.PlacementPoints) == 0 && table.KillPoints == 0 {
+		description := table.Description
+		table = DefaultPointTable()
+		table.Description = description
+	}
+	if len(table.TieBreakers) == 0 {
+		table.TieBreakers = defaultTieBreakers
+	}
+	return table
+}
+
+func validPointTable(table PointTable) bool {
+	if table.KillPoints < 0 {
+		return false
+	}
+	for _, points := range table.PlacementPoints {
+		if points < 0 {
+			return false
+		}
+	}
+	for _, tieBreaker := range table.TieBreakers {
+		if tieBreaker != TieBreakKills && tieBreaker != TieBreakBestPlacement && tieBreaker != TieBreakLastPlacement {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPoints(table PointTable, placement int, kills int) int {
+	points := kills * table.KillPoints
+	if placement >= 1 && placement <= len(table.PlacementPoints) {
+		points += table.PlacementPoints[placement-1]
+	}
+	return points
+}
+
+// computeGroupStandings adds up the group's match results into its table,
+// matches count in the order they were played
+func computeGroupStandings(group Groups, table PointTable) []Standing {
+	lines := map[string]*Standing{}
+	standings := []Standing{}
+	for _, team := range group.Teams {
+		standings = append(standings, Standing{TeamID: team.TeamID, TeamName: team.TeamName})
+	}
+	for i := range standings {
+		lines[standings[i].TeamID] = &standings[i]
+	}
+	for _, match := range group.Rounds {
+		for _, result := range match.Results {
+			line, ok := lines[result.TeamID]
+			if !ok {
+				continue
+			}
+			line.Points += matchPoints(table, result.Placement, result.Kills)
+			line.Kills += result.Kills
+			if result.Placement > 0 && (line.BestPlacement == 0 || result.Placement < line.BestPlacement) {
+				line.BestPlacement = result.Placement
+			}
+			line.LastPlacement = result.Placement
+		}
+	}
+	return rankStandingsBy(standings, table.TieBreakers)
+}
+
+// SetPointTable changes a tournament's scoring, only before it goes live so
+// no played match is scored twice
+func SetPointTable(db *mongo.Database, organizer User, tournamentID string, table PointTable) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can change the point table")
+	}
+	if !validPointTable(table) {
+		return errors.New("point table has negative points or an unknown tie breaker")
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": bson.M{"$in": []string{
+			StatusDraft, StatusPublished, StatusRegistrationOpen, StatusRegistrationClosed,
+		}}},
+		bson.M{"$set": bson.M{"pointtable": table}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("tournament has already started")
+	}
+	return nil
+}
+
+// withMatchResults is the group with one match's results replaced, or a new
+// match added when matchid is empty, and its standings worked out again
+func withMatchResults(tournament Tournaments, r int, group Groups, matchid string, results []MatchResult) (Groups, error) {
+	table := scoringFor(tournament)
+	members := map[string]bool{}
+	for _, team := range group.Teams {
+		members[team.TeamID] = true
+	}
+	entered := map[string]bool{}
+	placements := map[int]bool{}
+	for i, result := range results {
+		if !members[result.TeamID] {
+			return Groups{}, errors.New("team " + result.TeamID + " is not in " + group.Group)
+		}
+		if entered[result.TeamID] {
+			return Groups{}, errors.New("team " + result.TeamID + " has two results")
+		}
+		if result.Placement < 1 || result.Kills < 0 {
+			return Groups{}, errors.New("team " + result.TeamID + " needs a placement from 1 and kills from 0")
+		}
+		if placements[result.Placement] {
+			return Groups{}, errors.New("placement " + strconv.Itoa(result.Placement) + " is taken twice")
+		}
+		entered[result.TeamID] = true
+		placements[result.Placement] = true
+		results[i].Points = matchPoints(table, result.Placement, result.Kills)
+	}
+
+	matches := append([]Match{}, group.Rounds...)
+	if matchid == "" {
+		matches = append(matches, Match{
+			MatchID: primitive.NewObjectID().Hex(),
+			Title:   "Match " + strconv.Itoa(len(matches)+1),
+			MapName: tournament.Rounds[r].MapName,
+			Status:  MatchCompleted,
+			Results: results,
+		})
+	} else {
+		m, found := findGroupMatch(group, matchid)
+		if !found {
+			return Groups{}, errors.New("no match " + matchid + " in " + group.Group)
+		}
+		matches[m].Results = results
+		matches[m].Status = MatchCompleted
+	}
+	group.Rounds = matches
+	group.Standings = computeGroupStandings(group, table)
+	return group, nil
+}
+
+// notDisputed matches a group without open disputes, whose standings may
+// still change
+var notDisputed = bson.M{"$not": bson.M{"$gt": 0}}
+
+// SetMatchResults enters every team's placement and kills for one match of
+// a group and recomputes the group's standings. An empty matchid adds the
+// next match of the group.
+func SetMatchResults(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, matchid string, results []MatchResult) (Groups, error) {
+	if !IsOrganizer(organizer) {
+		return Groups{}, errors.New("only organizers can enter results")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+	if err != nil {
+		return Groups{}, errors.New("tournament is not live")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return Groups{}, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return Groups{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	read := tournament.Rounds[r].Groups[g].Version
+	group, err := withMatchResults(tournament, r, tournament.Rounds[r].Groups[g], matchid, results)
+	if err != nil {
+		return Groups{}, err
+	}
+
+	// the group has to be the version we read, so two organizers entering
+	// different matches at once cannot drop each other's results
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":              tournamentID,
+			groupPath + ".groupid":      groupid,
+			groupPath + ".version":      versionIs(read),
+			groupPath + ".opendisputes": notDisputed,
+		},
+		bson.M{
+			"$set": bson.M{
+				groupPath + ".rounds":    group.Rounds,
+				groupPath + ".standings": group.Standings,
+			},
+			"$inc": bson.M{groupPath + ".version": 1},
+		})
+	if err != nil {
+		return Groups{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Groups{}, errors.New(group.Group + " changed or is disputed, try again once it is settled")
+	}
+	group.Version = read + 1
+	return group, nil
+}
+
+type GroupStandings struct {
+	GroupID   string
+	Group     string
+	Standings []Standing
+}
+
+// StandingsView is every group's table and the overall table of the teams
+// across them
+type StandingsView struct {
+	PointTable PointTable
+	Groups     []GroupStandings
+	Overall    []Standing
+}
+
+// GetStandings serves the battle royale tables of one round, or of every
+// round when qualifier is empty, with penalties applied
+func GetStandings(db *mongo.Database, tournamentID string, qualifier string) (StandingsView, bool) {
+	tournament := GetTournament(db, tournamentID)
+	if tournament.TournamentID == "" {
+		return StandingsView{}, false
+	}
+	tournament = applyPenalties(tournament, activePenalties(db, tournamentID))
+	table := scoringFor(tournament)
+	view := StandingsView{PointTable: table, Groups: []GroupStandings{}, Overall: []Standing{}}
+	overall := map[string]*Standing{}
+	order := []string{}
+	for _, round := range tournament.Rounds {
+		if qualifier != "" && round.QualifierName != qualifier {
+			continue
+		}
+		for _, group := range round.Groups {
+			standings := groupTable(group, table.TieBreakers)
+			view.Groups = append(view.Groups, GroupStandings{GroupID: group.GroupID, Group: group.Group, Standings: standings})
+			for _, standing := range standings {
+				line, ok := overall[standing.TeamID]
+				if !ok {
+					line = &Standing{TeamID: standing.TeamID, TeamName: standing.TeamName}
+					overall[standing.TeamID] = line
+					order = append(order, standing.TeamID)
+				}
+				line.Points += standing.Points
+				line.Kills += standing.Kills
+				line.Deducted += standing.Deducted
+				line.Disqualified = line.Disqualified || standing.Disqualified
+				if standing.BestPlacement > 0 && (line.BestPlacement == 0 || standing.BestPlacement < line.BestPlacement) {
+					line.BestPlacement = standing.BestPlacement
+				}
+				if standing.LastPlacement > 0 {
+					line.LastPlacement = standing.LastPlacement
+				}
+			}
+		}
+	}
+	if qualifier != "" && len(view.Groups) == 0 {
+		if _, found := findRound(tournament, qualifier); !found {
+			return StandingsView{}, false
+		}
+	}
+	for _, teamid := range order {
+		view.Overall = append(view.Overall, *overall[teamid])
+	}
+	rankStandingsBy(view.Overall, table.TieBreakers)
+	return view, true
+}
+
+// findGroup is the index of the round's group with that groupid
+func findGroup(round Rounds, groupid string) (int, bool) {
+	for i, group := range round.Groups {
+		if group.GroupID == groupid {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func findGroupMatch(group Groups, matchid string) (int, bool) {
+	for i, match := range group.Rounds {
+		if match.MatchID == matchid {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// SubmitMatchResult records a captain's claim for their team in one match.
+// A team has at most one pending or verified claim per match.
+func SubmitMatchResult(db *mongo.Database, requester User, tournamentID string, qualifier string, groupid string, submission ResultSubmission) (ResultSubmission, error) {
+	if !CanEditTeam(db, requester, submission.TeamID) {
+		return ResultSubmission{}, errors.New("only the captain can submit results")
+	}
+	if submission.Placement < 1 || submission.Kills < 0 {
+		return ResultSubmission{}, errors.New("a result needs a placement from 1 and kills from 0")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+	if err != nil {
+		return ResultSubmission{}, errors.New("tournament is not live")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return ResultSubmission{}, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return ResultSubmission{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	if !groupHasTeam(group, submission.TeamID) {
+		return ResultSubmission{}, errors.New("team " + submission.TeamID + " is not in " + group.Group)
+	}
+	if _, found := findGroupMatch(group, submission.MatchID); !found {
+		return ResultSubmission{}, errors.New("no match " + submission.MatchID + " in " + group.Group)
+	}
+
+	submission.SubmissionID = primitive.NewObjectID().Hex()
+	submission.SubmittedBy = requester.User_uuid
+	submission.SubmittedAt = time.Now().UTC()
+	submission.Status = "pending"
+	submission.ReviewedBy, submission.ReviewedAt, submission.ReviewNote = "", time.Time{}, ""
+	// a review writes the whole results list, the version makes it notice a
+	// submission that came in meanwhile
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive},
+		bson.M{
+			"$push": bson.M{"rounds.$[r].groups.$[g].results": submission},
+			"$inc":  bson.M{"rounds.$[r].groups.$[g].version": 1},
+		},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"r.qualifiername": qualifier},
+			bson.M{
+				"g.groupid": groupid,
+				"g.results": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+					"matchid": submission.MatchID,
+					"teamid":  submission.TeamID,
+					"status":  bson.M{"$in": []string{"pending", "verified"}},
+				}}},
+			},
+		}}))
+	if err != nil {
+		return ResultSubmission{}, err
+	}
+	if res.ModifiedCount == 0 {
+		return ResultSubmission{}, errors.New("team " + submission.TeamID + " already has a result in for this match")
+	}
+	return submission, nil
+}
+
+// recordResult puts one team's finish into the match, replacing the team's
+// earlier one. The placement must not belong to another team.
+func recordResult(match Match, result MatchResult, table PointTable) (Match, error) {
+	results := []MatchResult{}
+	for _, existing := range match.Results {
+		if existing.TeamID == result.TeamID {
+			continue
+		}
+		if existing.Placement == result.Placement {
+			return match, errors.New("placement " + strconv.Itoa(result.Placement) + " is already recorded for team " + existing.TeamID)
+		}
+		results = append(results, existing)
+	}
+	result.Points = matchPoints(table, result.Placement, result.Kills)
+	match.Results = append(results, result)
+	match.Status = MatchCompleted
+	return match, nil
+}
+
+// ReviewMatchResult verifies or rejects a pending submission, a verified one
+// becomes the team's result for the match and the standings follow
+func ReviewMatchResult(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, submissionID string, approve bool, note string) (Groups, error) {
+	if !IsOrganizer(organizer) {
+		return Groups{}, errors.New("only organizers can review results")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+	if err != nil {
+		return Groups{}, errors.New("tournament is not live")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return Groups{}, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return Groups{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	index := -1
+	for i, submission := range group.Results {
+		if submission.SubmissionID == submissionID && submission.Status == "pending" {
+			index = i
+		}
+	}
+	if index < 0 {
+		return Groups{}, errors.New("submission " + submissionID + " is not waiting for review")
+	}
+
+	group.Results = append([]ResultSubmission{}, group.Results...)
+	submission := &group.Results[index]
+	submission.Status = "rejected"
+	submission.ReviewedBy = organizer.User_uuid
+	submission.ReviewedAt = time.Now().UTC()
+	submission.ReviewNote = note
+	if approve {
+		submission.Status = "verified"
+		m, found := findGroupMatch(group, submission.MatchID)
+		if !found {
+			return Groups{}, errors.New("no match " + submission.MatchID + " in " + group.Group)
+		}
+		table := scoringFor(tournament)
+		match, err := recordResult(group.Rounds[m], MatchResult{
+			TeamID:    submission.TeamID,
+			Placement: submission.Placement,
+			Kills:     submission.Kills,
+		}, table)
+		if err != nil {
+			return Groups{}, err
+		}
+		group.Rounds = append([]Match{}, group.Rounds...)
+		group.Rounds[m] = match
+		group.Standings = computeGroupStandings(group, table)
+	}
+
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	submissionPath := groupPath + ".results." + strconv.Itoa(index)
+	filter := bson.M{
+		"tournamentid":                   tournamentID,
+		groupPath + ".groupid":           groupid,
+		groupPath + ".version":           versionIs(group.Version),
+		submissionPath + ".submissionid": submissionID,
+		submissionPath + ".status":       "pending",
+	}
+	if approve {
+		filter[groupPath+".opendisputes"] = notDisputed
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		filter,
+		bson.M{
+			"$set": bson.M{
+				groupPath + ".results":   group.Results,
+				groupPath + ".rounds":    group.Rounds,
+				groupPath + ".standings": group.Standings,
+			},
+			"$inc": bson.M{groupPath + ".version": 1},
+		})
+	if err != nil {
+		return Groups{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Groups{}, errors.New(group.Group + " changed or is disputed, try again once it is settled")
+	}
+	group.Version++
+	return group, nil
+}
+
+// ResultConflict points at submissions that cannot all be right
+type ResultConflict struct {
+	Kind          string // "placement" when teams claim the same place, "recorded" when a claim differs from the recorded result
+	TeamID        string
+	Placement     int
+	SubmissionIDs []string
+}
+
+// MatchSubmissions lines up what the teams claimed for a match against what
+// is recorded
+type MatchSubmissions struct {
+	MatchID     string
+	Title       string
+	Recorded    []MatchResult
+	Submissions []ResultSubmission
+	Conflicts   []ResultConflict
+}
+
+// matchConflicts compares the open claims of one match with each other and
+// with the recorded results
+func matchConflicts(match Match, submissions []ResultSubmission) []ResultConflict {
+	conflicts := []ResultConflict{}
+	recorded := map[string]MatchResult{}
+	for _, result := range match.Results {
+		recorded[result.TeamID] = result
+	}
+	byPlacement := map[int][]ResultSubmission{}
+	placements := []int{}
+	for _, submission := range submissions {
+		if submission.Status == "rejected" {
+			continue
+		}
+		if _, ok := byPlacement[submission.Placement]; !ok {
+			placements = append(placements, submission.Placement)
+		}
+		byPlacement[submission.Placement] = append(byPlacement[submission.Placement], submission)
+		if result, ok := recorded[submission.TeamID]; ok && submission.Status == "pending" &&
+			(result.Placement != submission.Placement || result.Kills != submission.Kills) {
+			conflicts = append(conflicts, ResultConflict{
+				Kind:          "recorded",
+				TeamID:        submission.TeamID,
+				Placement:     submission.Placement,
+				SubmissionIDs: []string{submission.SubmissionID},
+			})
+		}
+	}
+	sort.Ints(placements)
+	for _, placement := range placements {
+		claims := byPlacement[placement]
+		if len(claims) < 2 {
+			continue
+		}
+		conflict := ResultConflict{Kind: "placement", Placement: placement, SubmissionIDs: []string{}}
+		for _, claim := range claims {
+			conflict.SubmissionIDs = append(conflict.SubmissionIDs, claim.SubmissionID)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// GetResultSubmissions is the organizer's view of a group's submissions,
+// match by match with the conflicts between them
+func GetResultSubmissions(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string) ([]MatchSubmissions, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can review results")
+	}
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return nil, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return nil, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	view := []MatchSubmissions{}
+	for _, match := range group.Rounds {
+		submissions := []ResultSubmission{}
+		for _, submission := range group.Results {
+			if submission.MatchID == match.MatchID {
+				submissions = append(submissions, submission)
+			}
+		}
+		view = append(view, MatchSubmissions{
+			MatchID:     match.MatchID,
+			Title:       match.Title,
+			Recorded:    match.Results,
+			Submissions: submissions,
+			Conflicts:   matchConflicts(match, submissions),
+		})
+	}
+	return view, nil
+}
+
+// SetGroupStandings lets an organizer enter a group's table by hand
+func SetGroupStandings(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, standings []Standing) bool {
+	if !IsOrganizer(organizer) {
+		return false
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive},
+		bson.M{"$set": bson.M{"rounds.$[r].groups.$[g].standings": RankStandings(standings)}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"r.qualifiername": qualifier},
+			bson.M{"g.groupid": groupid, "g.opendisputes": notDisputed},
+		}}))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return res.ModifiedCount == 1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// roundTables is the round's ranked teamids, one table per group, and the
+// order used to compare teams from different groups. A bracket is a single
+// table ranked by how far each team got.
+func roundTables(round Rounds, tieBreakers []string) ([][]string, func(a string, b string) bool) {
+	tables := [][]string{}
+	if round.Bracket != nil {
+		ranking := bracketRanking(*round.Bracket)
+		place := map[string]int{}
+		for i, teamid := range ranking {
+			place[teamid] = i
+		}
+		return append(tables, ranking), func(a string, b string) bool { return place[a] < place[b] }
+	}
+	if round.Stage != nil {
+		lines := map[string]StageStanding{}
+		index := map[string]int{}
+		for _, line := range round.Stage.Table {
+			lines[line.TeamID] = line
+			if _, ok := index[line.Group]; !ok {
+				index[line.Group] = len(tables)
+				tables = append(tables, []string{})
+			}
+			tables[index[line.Group]] = append(tables[index[line.Group]], line.TeamID)
+		}
+		return tables, func(a string, b string) bool { return stageStandingBefore(lines[a], lines[b]) }
+	}
+	lines := map[string]Standing{}
+	for _, group := range round.Groups {
+		table := []string{}
+		for _, standing := range groupTable(group, tieBreakers) {
+			lines[standing.TeamID] = standing
+			table = append(table, standing.TeamID)
+		}
+		tables = append(tables, table)
+	}
+	return tables, func(a string, b string) bool { return standingBeforeBy(lines[a], lines[b], tieBreakers) }
+}
+
+// selectQualifiers picks the round's qualifying teams: an even share of the
+// top of every group, the rest of the places go to the best remaining teams
+// across groups. Forced includes replace the lowest automatic picks.
+func selectQualifiers(round Rounds, advancement RoundAdvancement, tieBreakers []string) []string {
+	total := round.NumOfQualifyingTeamsThisRound
+	ranked, before := roundTables(round, tieBreakers)
+	tables := [][]string{}
+	for _, table := range ranked {
+		kept := []string{}
+		for _, teamid := range table {
+			if !containsString(advancement.Exclude, teamid) {
+				kept = append(kept, teamid)
+			}
+		}
+		tables = append(tables, kept)
+	}
+	if len(tables) == 0 {
+		return []string{}
+	}
+
+	qualified := []string{}
+	remaining := []string{}
+	share := total / len(tables)
+	for _, table := range tables {
+		for i, teamid := range table {
+			if i < share {
+				qualified = append(qualified, teamid)
+			} else {
+				remaining = append(remaining, teamid)
+			}
+		}
+	}
+	sort.SliceStable(remaining, func(a, b int) bool { return before(remaining[a], remaining[b]) })
+	for i := 0; len(qualified) < total && i < len(remaining); i++ {
+		qualified = append(qualified, remaining[i])
+	}
+	sort.SliceStable(qualified, func(a, b int) bool { return before(qualified[a], qualified[b]) })
+
+	automatic := []string{}
+	for _, teamid := range qualified {
+		if !containsString(advancement.Include, teamid) {
+			automatic = append(automatic, teamid)
+		}
+	}
+	forced := []string{}
+	for _, teamid := range advancement.Include {
+		if teamInRound(round, teamid) && !containsString(forced, teamid) {
+			forced = append(forced, teamid)
+		}
+	}
+	keep := total - len(forced)
+	if keep < 0 {
+		keep = 0
+	}
+	if keep < len(automatic) {
+		automatic = automatic[:keep]
+	}
+	result := append(automatic, forced...)
+	for _, teamid := range advancement.Wildcards {
+		if !containsString(result, teamid) {
+			result = append(result, teamid)
+		}
+	}
+	return result
+}
+
+// CompleteRound locks the round, works out who qualifies and seeds them
+// into the next round's groups, bracket or stage in rank order
+func CompleteRound(db *mongo.Database, organizer User, tournamentID string, qualifier string, advancement RoundAdvancement) ([]Groups, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can complete rounds")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+	if err != nil {
+		return nil, errors.New("tournament is not live")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return nil, errors.New("no round " + qualifier)
+	}
+	if r+1 >= len(tournament.Rounds) {
+		return nil, errors.New("round " + qualifier + " is the last round")
+	}
+	round, next := tournament.Rounds[r], tournament.Rounds[r+1]
+	if round.QualifiedTeams != nil {
+		return nil, errors.New("round " + qualifier + " is already completed")
+	}
+	if round.NumOfQualifyingTeamsThisRound <= 0 {
+		return nil, errors.New("round " + qualifier + " has no qualifying places")
+	}
+	if round.Stage != nil && !stageFinished(*round.Stage) {
+		return nil, errors.New("round " + qualifier + " still has matches to play")
+	}
+	if round.Bracket != nil && round.Bracket.Champion == "" {
+		return nil, errors.New("round " + qualifier + " has no champion yet")
+	}
+	for _, group := range round.Groups {
+		if group.OpenDisputes > 0 {
+			return nil, errors.New(group.Group + " has open disputes")
+		}
+	}
+
+	penalties := activePenalties(db, tournamentID)
+	round = applyPenalties(tournament, penalties).Rounds[r]
+	for _, penalty := range penalties {
+		if penalty.Kind == "disqualification" && penalty.User_uuid == "" {
+			advancement.Exclude = append(advancement.Exclude, penalty.TeamID)
+		}
+	}
+
+	teams := map[string]Team{}
+	for _, group := range round.Groups {
+		for _, team := range group.Teams {
+			teams[team.TeamID] = team
+		}
+	}
+	for _, team := range tournament.Teams {
+		if _, ok := teams[team.TeamID]; !ok {
+			teams[team.TeamID] = team
+		}
+	}
+	qualifiedTeams := []Team{}
+	qualifiedIDs := []string{}
+	for _, teamid := range selectQualifiers(round, advancement, scoringFor(tournament).TieBreakers) {
+		if team, ok := teams[teamid]; ok {
+			qualifiedTeams = append(qualifiedTeams, team)
+			qualifiedIDs = append(qualifiedIDs, teamid)
+		}
+	}
+
+	roundPath := "rounds." + strconv.Itoa(r)
+	nextPath := "rounds." + strconv.Itoa(r+1)
+	update := bson.M{
+		roundPath + ".islocked":       true,
+		roundPath + ".qualifiedteams": qualifiedIDs,
+	}
+	groups := []Groups{}
+	if next.Format == FormatSingleElimination || next.Format == FormatDoubleElimination {
+		bracket, err := BuildBracket(next.Format, qualifiedIDs)
+		if err != nil {
+			return nil, err
+		}
+		update[nextPath+".bracket"] = bracket
+	} else if next.Format == FormatSwiss || next.Format == FormatRoundRobin {
+		stage, err := BuildStage(next.Format, qualifiedIDs, next.NumberOfTeamsPerGroup, next.SwissRounds, next.Slots)
+		if err != nil {
+			return nil, err
+		}
+		update[nextPath+".stage"] = stage
+	} else {
+		groups, err = BuildSeededGroups(qualifiedTeams, next.NumberOfTeamsPerGroup, next.Slots, "", SeedRanked)
+		if err != nil {
+			return nil, err
+		}
+		update[nextPath+".groups"] = groups
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":               tournamentID,
+			roundPath + ".qualifiername": qualifier,
+			// a round is completed once, a second call must not replace the
+			// next round's groups and whatever was played in them
+			roundPath + ".qualifiedteams": nil,
+			nextPath + ".qualifiername":   next.QualifierName,
+			nextPath + ".islocked":        bson.M{"$ne": true},
+		},
+		bson.M{"$set": update, "$inc": bson.M{nextPath + ".version": 1}})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("round " + qualifier + " changed or is already completed")
+	}
+	return groups, nil
+}
+
+// defaultGroupDuration is used when the slot request does not say how long
+// the group plays, in minutes
+const defaultGroupDuration = "45"
+
+// groupName is "Group A" ... "Group Z", "Group AA" ...
+func groupName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return "Group " + name
+}
+
+func findRound(tournament Tournaments, qualifier string) (int, bool) {
+	for i, round := range tournament.Rounds {
+		if round.QualifierName == qualifier {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func registeredTeam(tournament Tournaments, teamid string) (Team, bool) {
+	for _, team := range tournament.Teams {
+		if team.TeamID == teamid {
+			return team, true
+		}
+	}
+	return Team{}, false
+}
+
+func teamInRound(round Rounds, teamid string) bool {
+	if round.Stage != nil && containsString(round.Stage.Seeds, teamid) {
+		return true
+	}
+	for _, group := range round.Groups {
+		if groupHasTeam(group, teamid) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupHasTeam(group Groups, teamid string) bool {
+	for _, team := range group.Teams {
+		if team.TeamID == teamid {
+			return true
+		}
+	}
+	return false
+}
+
+// maxGroups is how many groups the round can hold, TotalTeams spread over
+// groups of NumberOfTeamsPerGroup
+func maxGroups(tournament Tournaments, round Rounds) int {
+	teams := tournament.TotalTeams
+	if teams <= 0 {
+		teams = len(tournament.Teams)
+	}
+	return (teams + round.NumberOfTeamsPerGroup - 1) / round.NumberOfTeamsPerGroup
+}
+
+// slotAllocationAttempts bounds the retries when concurrent joins keep
+// changing the round under us
+const slotAllocationAttempts = 10
+
+// AddTeamInTournamentGroup puts a registered team into a group of the round
+// starting at the requested slot, opening a new group when the existing ones
+// are full. Every write carries the state it was decided on in its filter, so
+// concurrent joins either both fit or one of them retries. It returns the
+// group the team landed in.
+func AddTeamInTournamentGroup(db *mongo.Database, tournamentID string, qualifier string, slot Groups, teamid string) (Groups, error) {
+	for attempt := 0; attempt < slotAllocationAttempts; attempt++ {
+		var tournament Tournaments
+		err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+			"tournamentid": tournamentID,
+			"status":       bson.M{"$in": []string{StatusRegistrationOpen, StatusRegistrationClosed}},
+		}).Decode(&tournament)
+		if err != nil {
+			return Groups{}, errors.New("tournament is not taking group slots")
+		}
+		r, found := findRound(tournament, qualifier)
+		if !found {
+			return Groups{}, errors.New("no round " + qualifier)
+		}
+		round := tournament.Rounds[r]
+		if round.NumberOfTeamsPerGroup <= 0 {
+			return Groups{}, errors.New("round " + qualifier + " has no group size")
+		}
+		if round.IsLocked || hasPassed(round.LockAt, time.Now()) {
+			return Groups{}, errors.New("round " + qualifier + " is locked")
+		}
+		if len(round.Slots) > 0 {
+			offered := false
+			for _, startingAt := range round.Slots {
+				if startingAt.Equal(slot.StartingAt) {
+					offered = true
+				}
+			}
+			if !offered {
+				return Groups{}, errors.New("round " + qualifier + " has no such slot")
+			}
+		}
+		team, registered := registeredTeam(tournament, teamid)
+		if !registered {
+			return Groups{}, errors.New("team is not registered in this tournament")
+		}
+		if teamInRound(round, teamid) {
+			return Groups{}, errors.New("team already has a group in this round")
+		}
+
+		roundPath := "rounds." + strconv.Itoa(r)
+		filter := bson.M{
+			"tournamentid":                     tournamentID,
+			"status":                           bson.M{"$in": []string{StatusRegistrationOpen, StatusRegistrationClosed}},
+			roundPath + ".qualifiername":       qualifier,
+			roundPath + ".groups.teams.teamid": bson.M{"$ne": teamid},
+		}
+
+		// an existing group at this slot with room left
+		raced := false
+		for g, group := range round.Groups {
+			if !group.StartingAt.Equal(slot.StartingAt) || len(group.Teams) >= round.NumberOfTeamsPerGroup {
+				continue
+			}
+			groupPath := roundPath + ".groups." + strconv.Itoa(g)
+			filter[groupPath+".groupid"] = group.GroupID
+			filter[groupPath+".teams."+strconv.Itoa(round.NumberOfTeamsPerGroup-1)] = bson.M{"$exists": false}
+			res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+				bson.M{"$push": bson.M{groupPath + ".teams": team}, "$inc": bson.M{roundPath + ".version": 1}})
+			if err != nil {
+				return Groups{}, err
+			}
+			if res.ModifiedCount == 1 {
+				group.Teams = append(group.Teams, team)
+				return group, nil
+			}
+			raced = true
+			break
+		}
+		if raced {
+			// another join changed the round first, look again
+			continue
+		}
+
+		// otherwise open a new group, if the round has room for one
+		count := len(round.Groups)
+		if count >= maxGroups(tournament, round) {
+			return Groups{}, errors.New("round " + qualifier + " is full")
+		}
+		filter[roundPath+".groups."+strconv.Itoa(count)] = bson.M{"$exists": false}
+		if count > 0 {
+			filter[roundPath+".groups."+strconv.Itoa(count-1)] = bson.M{"$exists": true}
+		}
+		duration := slot.Duration
+		if duration == "" {
+			duration = defaultGroupDuration
+		}
+		newGroup := Groups{
+			GroupID:    primitive.NewObjectID().Hex(),
+			Group:      groupName(count),
+			Teams:      []Team{team},
+			Rounds:     []Match{},
+			Results:    []ResultSubmission{},
+			StartingAt: slot.StartingAt,
+			Duration:   duration,
+		}
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+			bson.M{"$push": bson.M{roundPath + ".groups": newGroup}, "$inc": bson.M{roundPath + ".version": 1}})
+		if err != nil {
+			return Groups{}, err
+		}
+		if res.ModifiedCount == 1 {
+			return newGroup, nil
+		}
+	}
+	return Groups{}, errors.New("slot is busy, try again")
+}
+
+// reportAttempts bounds the retries when other reports keep changing a
+// bracket or stage under us
+const reportAttempts = 10
+
+// versionIs matches a version counter, documents from before it was kept
+// have none
+func versionIs(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": []interface{}{nil, 0}}
+	}
+	return version
+}
+
+// Match statuses of a bracket, battle royale matches go from scheduled to
+// live to completed
+const (
+	MatchPending   = "pending"
+	MatchReady     = "ready"
+	MatchCompleted = "completed"
+	MatchBye       = "bye"
+	MatchVoid      = "void"
+	MatchScheduled = "scheduled"
+	MatchLive      = "live"
+)
+
+// seedOrder lists seeds in bracket position order so that 1 and 2 can only
+// meet in the final, {1, 8, 4, 5, 2, 7, 3, 6} for eight
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := []int{}
+		for _, seed := range order {
+			next = append(next, seed, 2*len(order)+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+func matchID(prefix string, round int, position int) string {
+	return prefix + strconv.Itoa(round) + "-" + strconv.Itoa(position)
+}
+
+func slotFor(position int) string {
+	if position%2 == 1 {
+		return "A"
+	}
+	return "B"
+}
+
+// BuildBracket lays out a single or double elimination bracket for the teams
+// in seed order, missing seeds become byes
+func BuildBracket(format string, seeds []string) (Bracket, error) {
+	if format != FormatSingleElimination && format != FormatDoubleElimination {
+		return Bracket{}, errors.New("unknown bracket format " + format)
+	}
+	if len(seeds) < 2 {
+		return Bracket{}, errors.New("a bracket needs at least two teams")
+	}
+	size := 2
+	if format == FormatDoubleElimination {
+		size = 4
+	}
+	for size < len(seeds) {
+		size *= 2
+	}
+	winnersRounds := 0
+	for n := size; n > 1; n /= 2 {
+		winnersRounds++
+	}
+
+	bracket := Bracket{Format: format, Matches: []HeadToHeadMatch{}}
+	for r := 1; r <= winnersRounds; r++ {
+		count := size >> r
+		for p := 1; p <= count; p++ {
+			match := HeadToHeadMatch{
+				MatchID:  matchID("W", r, p),
+				Side:     "winners",
+				Round:    r,
+				Position: p,
+				Status:   MatchPending,
+			}
+			if r < winnersRounds {
+				match.WinnerTo, match.WinnerSlot = matchID("W", r+1, (p+1)/2), slotFor(p)
+			} else if format == FormatDoubleElimination {
+				match.WinnerTo, match.WinnerSlot = "GF1", "A"
+			}
+			if format == FormatDoubleElimination {
+				if r == 1 {
+					match.LoserTo, match.LoserSlot = matchID("L", 1, (p+1)/2), slotFor(p)
+				} else {
+					// crossing over keeps early rematches apart
+					match.LoserTo, match.LoserSlot = matchID("L", 2*(r-1), count+1-p), "B"
+				}
+			}
+			bracket.Matches = append(bracket.Matches, match)
+		}
+	}
+
+	if format == FormatDoubleElimination {
+		losersRounds := 2 * (winnersRounds - 1)
+		for t := 1; t <= losersRounds; t++ {
+			count := size >> ((t+1)/2 + 1)
+			for p := 1; p <= count; p++ {
+				match := HeadToHeadMatch{
+					MatchID:  matchID("L", t, p),
+					Side:     "losers",
+					Round:    t,
+					Position: p,
+					Status:   MatchPending,
+				}
+				switch {
+				case t == losersRounds:
+					match.WinnerTo, match.WinnerSlot = "GF1", "B"
+				case t%2 == 1:
+					// odd rounds feed the next round's A slot one to one
+					match.WinnerTo, match.WinnerSlot = matchID("L", t+1, p), "A"
+				default:
+					match.WinnerTo, match.WinnerSlot = matchID("L", t+1, (p+1)/2), slotFor(p)
+				}
+				bracket.Matches = append(bracket.Matches, match)
+			}
+		}
+		bracket.Matches = append(bracket.Matches,
+			HeadToHeadMatch{MatchID: "GF1", Side: "final", Round: 1, Position: 1, Status: MatchPending},
+			HeadToHeadMatch{MatchID: "GF2", Side: "final", Round: 2, Position: 1, Status: MatchPending})
+	}
+
+	order := seedOrder(size)
+	for p := 1; p <= size/2; p++ {
+		for i, slot := range []string{"A", "B"} {
+			seed := order[2*(p-1)+i]
+			team := ""
+			if seed <= len(seeds) {
+				team = seeds[seed-1]
+			}
+			placeInMatch(&bracket, matchID("W", 1, p), slot, team)
+		}
+	}
+	settleBracket(&bracket)
+	return bracket, nil
+}
+
+// bracketSeeds reads the seeds back from the first round, best first
+func bracketSeeds(bracket Bracket) []string {
+	size := 0
+	for _, match := range bracket.Matches {
+		if match.Side == "winners" && match.Round == 1 {
+			size += 2
+		}
+	}
+	order := seedOrder(size)
+	seeds := make([]string, size)
+	for p := 1; p <= size/2; p++ {
+		if match := findMatch(&bracket, matchID("W", 1, p)); match != nil {
+			seeds[order[2*(p-1)]-1], seeds[order[2*(p-1)+1]-1] = match.TeamA, match.TeamB
+		}
+	}
+	for len(seeds) > 0 && seeds[len(seeds)-1] == "" {
+		seeds = seeds[:len(seeds)-1]
+	}
+	return seeds
+}
+
+func findMatch(bracket *Bracket, id string) *HeadToHeadMatch {
+	for i := range bracket.Matches {
+		if bracket.Matches[i].MatchID == id {
+			return &bracket.Matches[i]
+		}
+	}
+	return nil
+}
+
+// placeInMatch decides one slot of a match, an empty team is a bye
+func placeInMatch(bracket *Bracket, id string, slot string, team string) {
+	match := findMatch(bracket, id)
+	if match == nil {
+		return
+	}
+	if slot == "A" {
+		match.TeamA, match.ReadyA = team, true
+	} else {
+		match.TeamB, match.ReadyB = team, true
+	}
+}
+
+// finishMatch records the result and moves both teams on
+func finishMatch(bracket *Bracket, match *HeadToHeadMatch, winner string, loser string, status string) {
+	match.Winner, match.Loser, match.Status = winner, loser, status
+	if match.MatchID == "GF1" {
+		reset := findMatch(bracket, "GF2")
+		if winner == match.TeamA || loser == "" {
+			// the winners bracket champion has not lost yet
+			bracket.Champion = winner
+			reset.Status = MatchVoid
+		} else {
+			placeInMatch(bracket, "GF2", "A", match.TeamA)
+			placeInMatch(bracket, "GF2", "B", match.TeamB)
+		}
+		return
+	}
+	if match.WinnerTo == "" {
+		bracket.Champion = winner
+		return
+	}
+	placeInMatch(bracket, match.WinnerTo, match.WinnerSlot, winner)
+	if match.LoserTo != "" {
+		placeInMatch(bracket, match.LoserTo, match.LoserSlot, loser)
+	}
+}
+
+// bracketRanking is the champion first and then every other team by the
+// match that knocked it out, the grand final before the losers bracket and
+// later rounds before earlier ones. Teams knocked out in the same round keep
+// their bracket order.
+func bracketRanking(bracket Bracket) []string {
+	sides := map[string]int{"winners": 0, "losers": 1, "final": 2}
+	type knockout struct {
+		teamid string
+		side   int
+		round  int
+	}
+	last := map[string]int{}
+	knockouts := []knockout{}
+	for _, match := range bracket.Matches {
+		if match.Status != MatchCompleted || match.Loser == "" {
+			continue
+		}
+		// a team can lose twice in double elimination, the last loss is the
+		// one that counts
+		out := knockout{teamid: match.Loser, side: sides[match.Side], round: match.Round}
+		if i, ok := last[match.Loser]; ok {
+			knockouts[i] = out
+			continue
+		}
+		last[match.Loser] = len(knockouts)
+		knockouts = append(knockouts, out)
+	}
+	sort.SliceStable(knockouts, func(a, b int) bool {
+		if knockouts[a].side != knockouts[b].side {
+			return knockouts[a].side > knockouts[b].side
+		}
+		return knockouts[a].round > knockouts[b].round
+	})
+	ranking := []string{}
+	if bracket.Champion != "" {
+		ranking = append(ranking, bracket.Champion)
+	}
+	for _, out := range knockouts {
+		if out.teamid != bracket.Champion {
+			ranking = append(ranking, out.teamid)
+		}
+	}
+	return ranking
+}
+
+// settleBracket opens matches whose teams are known and walks byes through
+// until nothing changes
+func settleBracket(bracket *Bracket) {
+	for changed := true; changed; {
+		changed = false
+		for i := range bracket.Matches {
+			match := &bracket.Matches[i]
+			if match.Status != MatchPending || !match.ReadyA || !match.ReadyB {
+				continue
+			}
+			changed = true
+			switch {
+			case match.TeamA != "" && match.TeamB != "":
+				match.Status = MatchReady
+			case match.TeamA != "":
+				finishMatch(bracket, match, match.TeamA, "", MatchBye)
+			default:
+				finishMatch(bracket, match, match.TeamB, "", MatchBye)
+			}
+		}
+	}
+}
+
+// ReportBracketMatch records the score of a ready match and advances the
+// winner, and in double elimination the loser
+func ReportBracketMatch(db *mongo.Database, organizer User, tournamentID string, qualifier string, id string, scoreA int, scoreB int) (Bracket, error) {
+	if !IsOrganizer(organizer) {
+		return Bracket{}, errors.New("only organizers can report matches")
+	}
+	if scoreA < 0 || scoreB < 0 {
+		return Bracket{}, errors.New("scores can't be negative")
+	}
+	if scoreA == scoreB {
+		return Bracket{}, errors.New("a bracket match needs a winner")
+	}
+	for attempt := 0; attempt < reportAttempts; attempt++ {
+		var tournament Tournaments
+		err := db.Collection("Tournaments").FindOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+		if err != nil {
+			return Bracket{}, errors.New("tournament is not live")
+		}
+		r, found := findRound(tournament, qualifier)
+		if !found || tournament.Rounds[r].Bracket == nil {
+			return Bracket{}, errors.New("round " + qualifier + " has no bracket")
+		}
+		if tournament.Rounds[r].IsLocked {
+			return Bracket{}, errors.New("round " + qualifier + " is locked")
+		}
+		bracket := *tournament.Rounds[r].Bracket
+		index := -1
+		for i := range bracket.Matches {
+			if bracket.Matches[i].MatchID == id {
+				index = i
+			}
+		}
+		if index < 0 || bracket.Matches[index].Status != MatchReady {
+			return Bracket{}, errors.New("match " + id + " is not waiting for a result")
+		}
+		match := &bracket.Matches[index]
+		match.ScoreA, match.ScoreB = scoreA, scoreB
+		if scoreA > scoreB {
+			finishMatch(&bracket, match, match.TeamA, match.TeamB, MatchCompleted)
+		} else {
+			finishMatch(&bracket, match, match.TeamB, match.TeamA, MatchCompleted)
+		}
+		settleBracket(&bracket)
+
+		// the whole bracket is written, so it has to be the version we read
+		// or another match's result and routing would be lost
+		read := bracket.Version
+		bracket.Version++
+		roundPath := "rounds." + strconv.Itoa(r)
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{
+				"tournamentid":                 tournamentID,
+				roundPath + ".qualifiername":   qualifier,
+				roundPath + ".bracket.version": versionIs(read),
+				roundPath + ".islocked":        bson.M{"$ne": true},
+			},
+			bson.M{"$set": bson.M{roundPath + ".bracket": bracket}})
+		if err != nil {
+			return Bracket{}, err
+		}
+		if res.MatchedCount == 1 {
+			return bracket, nil
+		}
+	}
+	return Bracket{}, errors.New("the bracket is busy, try again")
+}
+
+// GenerateBracket seeds an elimination round, by default the teams that
+// qualified from the previous round in rank order, or every registered team
+// by rating for the first round
+func GenerateBracket(db *mongo.Database, organizer User, tournamentID string, qualifier string, seeds []string) (Bracket, error) {
+	if !IsOrganizer(organizer) {
+		return Bracket{}, errors.New("only organizers can generate brackets")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": tournamentID,
+		"status":       bson.M{"$in": []string{StatusRegistrationClosed, StatusLive}},
+	}).Decode(&tournament)
+	if err != nil {
+		return Bracket{}, errors.New("tournament is not ready for brackets")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return Bracket{}, errors.New("no round " + qualifier)
+	}
+	if len(seeds) == 0 {
+		seeds = defaultSeeds(tournament, r)
+	}
+	seeds, err = checkSeeds(tournament, seeds)
+	if err != nil {
+		return Bracket{}, err
+	}
+	bracket, err := BuildBracket(tournament.Rounds[r].Format, seeds)
+	if err != nil {
+		return Bracket{}, err
+	}
+	roundPath := "rounds." + strconv.Itoa(r)
+	filter := bson.M{
+		"tournamentid":               tournamentID,
+		roundPath + ".qualifiername": qualifier,
+		roundPath + ".islocked":      bson.M{"$ne": true},
+		roundPath + ".bracket":       nil,
+	}
+	if previous := tournament.Rounds[r].Bracket; previous != nil {
+		if hasCompletedMatch(previous.Matches) {
+			return Bracket{}, errors.New("round " + qualifier + " already has results, the bracket can't be generated again")
+		}
+		// reports still holding the old bracket must not land on the new one
+		bracket.Version = previous.Version + 1
+		delete(filter, roundPath+".bracket")
+		filter[roundPath+".bracket.version"] = versionIs(previous.Version)
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+		bson.M{"$set": bson.M{roundPath + ".bracket": bracket}})
+	if err != nil {
+		return Bracket{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Bracket{}, errors.New("round " + qualifier + " is locked or its bracket changed")
+	}
+	return bracket, nil
+}
+
+// checkSeeds drops repeated teamids and refuses teams that are not
+// registered in the tournament
+func checkSeeds(tournament Tournaments, seeds []string) ([]string, error) {
+	checked := []string{}
+	for _, teamid := range seeds {
+		if containsString(checked, teamid) {
+			continue
+		}
+		if _, ok := registeredTeam(tournament, teamid); !ok {
+			return nil, errors.New("team " + teamid + " is not registered in the tournament")
+		}
+		checked = append(checked, teamid)
+	}
+	return checked, nil
+}
+
+func defaultSeeds(tournament Tournaments, r int) []string {
+	if r > 0 && len(tournament.Rounds[r-1].QualifiedTeams) > 0 {
+		return tournament.Rounds[r-1].QualifiedTeams
+	}
+	teams := append([]Team{}, tournament.Teams...)
+	sort.SliceStable(teams, func(a, b int) bool { return teams[a].Rating > teams[b].Rating })
+	seeds := []string{}
+	for _, team := range teams {
+		seeds = append(seeds, team.TeamID)
+	}
+	return seeds
+}
+
+// BracketView is a bracket with the team names the frontend needs to draw it
+type BracketView struct {
+	Bracket
+	TeamNames map[string]string
+}
+
+func GetBracket(db *mongo.Database, tournamentID string, qualifier string) (BracketView, bool) {
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found || tournament.Rounds[r].Bracket == nil {
+		return BracketView{}, false
+	}
+	view := BracketView{Bracket: *tournament.Rounds[r].Bracket, TeamNames: map[string]string{}}
+	for _, team := range tournament.Teams {
+		view.TeamNames[team.TeamID] = team.TeamName
+	}
+	return view, true
+}
+
+// swissRoundsFor is how many Swiss rounds it takes to leave one unbeaten team
+func swissRoundsFor(teams int) int {
+	rounds := 0
+	for 1<<rounds < teams {
+		rounds++
+	}
+	return rounds
+}
+
+// roundRobinSchedule pairs every team in the pool with every other one once
+// using the circle method, an empty team is the bye
+func roundRobinSchedule(teams []string) [][][2]string {
+	circle := append([]string{}, teams...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "")
+	}
+	n := len(circle)
+	schedule := [][][2]string{}
+	for r := 0; r < n-1; r++ {
+		pairs := [][2]string{}
+		for i := 0; i < n/2; i++ {
+			a, b := circle[i], circle[n-1-i]
+			if i == 0 && r%2 == 1 {
+				// the fixed team swaps sides every other round
+				a, b = b, a
+			}
+			pairs = append(pairs, [2]string{a, b})
+		}
+		schedule = append(schedule, pairs)
+		// the first team stays put, everyone else moves one place round
+		circle = append([]string{circle[0], circle[n-1]}, circle[1:n-1]...)
+	}
+	return schedule
+}
+
+func slotAt(slots []time.Time, round int) time.Time {
+	if round >= 1 && round <= len(slots) {
+		return slots[round-1]
+	}
+	return time.Time{}
+}
+
+// BuildStage lays out a Swiss or round robin round for the teams in seed
+// order. Round robin pools are snake seeded with at least perGroup teams
+// each, a Swiss stage only pairs its first round here.
+func BuildStage(format string, seeds []string, perGroup int, swissRounds int, slots []time.Time) (Stage, error) {
+	if format != FormatSwiss && format != FormatRoundRobin {
+		return Stage{}, errors.New("unknown stage format " + format)
+	}
+	if len(seeds) < 2 {
+		return Stage{}, errors.New("a stage needs at least two teams")
+	}
+	stage := Stage{Format: format, Seeds: seeds, Matches: []HeadToHeadMatch{}, Table: []StageStanding{}}
+
+	if format == FormatSwiss {
+		// up to n/2 rounds every team still has at least half the field
+		// left to meet, so there is always a pairing without rematches and
+		// pairSwiss finds it without searching every arrangement
+		limit := len(seeds) / 2
+		stage.Rounds = swissRounds
+		if stage.Rounds <= 0 {
+			stage.Rounds = swissRoundsFor(len(seeds))
+			if stage.Rounds > limit {
+				stage.Rounds = limit
+			}
+		}
+		if stage.Rounds > limit {
+			return Stage{}, errors.New("a swiss stage of " + strconv.Itoa(len(seeds)) + " teams can have at most " + strconv.Itoa(limit) + " rounds")
+		}
+		for _, teamid := range seeds {
+			stage.Table = append(stage.Table, StageStanding{TeamID: teamid})
+		}
+		pairSwissRound(&stage, slots)
+		return stage, nil
+	}
+
+	pools := 1
+	if perGroup >= 2 && len(seeds)/perGroup > 1 {
+		pools = len(seeds) / perGroup
+	}
+	members := make([][]string, pools)
+	for i, teamid := range seeds {
+		pool := i % pools
+		if (i/pools)%2 == 1 {
+			pool = pools - 1 - pool
+		}
+		members[pool] = append(members[pool], teamid)
+	}
+	for g, pool := range members {
+		group := groupName(g)
+		prefix := strings.TrimPrefix(group, "Group ")
+		for _, teamid := range pool {
+			stage.Table = append(stage.Table, StageStanding{TeamID: teamid, Group: group})
+		}
+		schedule := roundRobinSchedule(pool)
+		if len(schedule) > stage.Rounds {
+			stage.Rounds = len(schedule)
+		}
+		for r, pairs := range schedule {
+			position := 0
+			for _, pair := range pairs {
+				if pair[0] == "" || pair[1] == "" {
+					continue
+				}
+				position++
+				stage.Matches = append(stage.Matches, HeadToHeadMatch{
+					MatchID:    matchID(prefix, r+1, position),
+					Group:      group,
+					Round:      r + 1,
+					Position:   position,
+					StartingAt: slotAt(slots, r+1),
+					TeamA:      pair[0],
+					TeamB:      pair[1],
+					ReadyA:     true,
+					ReadyB:     true,
+					Status:     MatchReady,
+				})
+			}
+		}
+	}
+	stage.Table = stageTable(stage)
+	return stage, nil
+}
+
+// pairSwiss pairs the teams in order, the top half of every score group
+// against its bottom half, without repeating a match. Teams float down to
+// the next score group when their own one cannot be paired.
+func pairSwiss(order []string, points map[string]int, played map[string]bool) ([][2]string, bool) {
+	if len(order) == 0 {
+		return [][2]string{}, true
+	}
+	first := order[0]
+	same := 1
+	for same < len(order) && points[order[same]] == points[first] {
+		same++
+	}
+	half := same / 2
+	if half == 0 {
+		half = 1
+	}
+	candidates := []int{}
+	for i := half; i < same; i++ {
+		candidates = append(candidates, i)
+	}
+	for i := half - 1; i >= 1; i-- {
+		candidates = append(candidates, i)
+	}
+	for i := same; i < len(order); i++ {
+		candidates = append(candidates, i)
+	}
+	for _, i := range candidates {
+		if played[first+"|"+order[i]] {
+			continue
+		}
+		rest := append(append([]string{}, order[1:i]...), order[i+1:]...)
+		if pairs, ok := pairSwiss(rest, points, played); ok {
+			return append([][2]string{{first, order[i]}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// pairSwissRound adds the next Swiss round's matches. The lowest ranked team
+// that has not had a bye sits out when the count is odd.
+func pairSwissRound(stage *Stage, slots []time.Time) {
+	round := stage.CurrentRound + 1
+	seedIndex := map[string]int{}
+	for i, teamid := range stage.Seeds {
+		seedIndex[teamid] = i
+	}
+	points := map[string]int{}
+	for _, line := range stageTable(*stage) {
+		points[line.TeamID] = line.Points
+	}
+	played := map[string]bool{}
+	hadBye := map[string]bool{}
+	for _, match := range stage.Matches {
+		if match.Status == MatchBye {
+			hadBye[match.Winner] = true
+			continue
+		}
+		played[match.TeamA+"|"+match.TeamB] = true
+		played[match.TeamB+"|"+match.TeamA] = true
+	}
+
+	order := append([]string{}, stage.Seeds...)
+	sort.SliceStable(order, func(a, b int) bool {
+		if points[order[a]] != points[order[b]] {
+			return points[order[a]] > points[order[b]]
+		}
+		return seedIndex[order[a]] < seedIndex[order[b]]
+	})
+	bye := ""
+	if len(order)%2 == 1 {
+		out := len(order) - 1
+		for i := len(order) - 1; i >= 0; i-- {
+			if !hadBye[order[i]] {
+				out = i
+				break
+			}
+		}
+		bye = order[out]
+		order = append(order[:out], order[out+1:]...)
+	}
+	pairs, ok := pairSwiss(order, points, played)
+	if !ok {
+		// everyone has met already, take the rematches in table order
+		pairs = [][2]string{}
+		for i := 0; i+1 < len(order); i += 2 {
+			pairs = append(pairs, [2]string{order[i], order[i+1]})
+		}
+	}
+
+	for p, pair := range pairs {
+		stage.Matches = append(stage.Matches, HeadToHeadMatch{
+			MatchID:    matchID("S", round, p+1),
+			Round:      round,
+			Position:   p + 1,
+			StartingAt: slotAt(slots, round),
+			TeamA:      pair[0],
+			TeamB:      pair[1],
+			ReadyA:     true,
+			ReadyB:     true,
+			Status:     MatchReady,
+		})
+	}
+	if bye != "" {
+		stage.Matches = append(stage.Matches, HeadToHeadMatch{
+			MatchID:  matchID("S", round, len(pairs)+1),
+			Round:    round,
+			Position: len(pairs) + 1,
+			TeamA:    bye,
+			ReadyA:   true,
+			ReadyB:   true,
+			Winner:   bye,
+			Status:   MatchBye,
+		})
+	}
+	stage.CurrentRound = round
+}
+
+func stageStandingBefore(a StageStanding, b StageStanding) bool {
+	if a.Points != b.Points {
+		return a.Points > b.Points
+	}
+	if a.Buchholz != b.Buchholz {
+		return a.Buchholz > b.Buchholz
+	}
+	if a.ScoreDiff != b.ScoreDiff {
+		return a.ScoreDiff > b.ScoreDiff
+	}
+	return a.TeamID < b.TeamID
+}
+
+// stageTable works the table out from the stage's matches, ranked by points,
+// Buchholz in Swiss, then score difference, within each group
+func stageTable(stage Stage) []StageStanding {
+	lines := map[string]*StageStanding{}
+	table := []StageStanding{}
+	for _, line := range stage.Table {
+		table = append(table, StageStanding{TeamID: line.TeamID, Group: line.Group})
+	}
+	for i := range table {
+		lines[table[i].TeamID] = &table[i]
+	}
+	opponents := map[string][]string{}
+	for _, match := range stage.Matches {
+		switch match.Status {
+		case MatchBye:
+			if line, ok := lines[match.Winner]; ok {
+				line.Played++
+				line.Wins++
+				line.Points += 3
+			}
+		case MatchCompleted:
+			a, okA := lines[match.TeamA]
+			b, okB := lines[match.TeamB]
+			if !okA || !okB {
+				continue
+			}
+			a.Played++
+			b.Played++
+			a.ScoreDiff += match.ScoreA - match.ScoreB
+			b.ScoreDiff += match.ScoreB - match.ScoreA
+			switch match.Winner {
+			case "":
+				a.Draws++
+				b.Draws++
+				a.Points++
+				b.Points++
+			case match.TeamA:
+				a.Wins++
+				b.Losses++
+				a.Points += 3
+			default:
+				b.Wins++
+				a.Losses++
+				b.Points += 3
+			}
+			opponents[match.TeamA] = append(opponents[match.TeamA], match.TeamB)
+			opponents[match.TeamB] = append(opponents[match.TeamB], match.TeamA)
+		}
+	}
+	if stage.Format == FormatSwiss {
+		for i := range table {
+			for _, opponent := range opponents[table[i].TeamID] {
+				table[i].Buchholz += lines[opponent].Points
+			}
+		}
+	}
+
+	groupOrder := map[string]int{}
+	for _, line := range table {
+		if _, ok := groupOrder[line.Group]; !ok {
+			groupOrder[line.Group] = len(groupOrder)
+		}
+	}
+	sort.SliceStable(table, func(a, b int) bool {
+		if table[a].Group != table[b].Group {
+			return groupOrder[table[a].Group] < groupOrder[table[b].Group]
+		}
+		return stageStandingBefore(table[a], table[b])
+	})
+	for i := range table {
+		table[i].Rank = 1
+		if i > 0 && table[i-1].Group == table[i].Group {
+			table[i].Rank = table[i-1].Rank + 1
+		}
+	}
+	return table
+}
+
+func allPlayed(matches []HeadToHeadMatch) bool {
+	for _, match := range matches {
+		if match.Status == MatchReady {
+			return false
+		}
+	}
+	return true
+}
+
+// stageFinished is true once every match is played and a Swiss stage has
+// paired all its rounds
+func stageFinished(stage Stage) bool {
+	return allPlayed(stage.Matches) && (stage.Format != FormatSwiss || stage.CurrentRound >= stage.Rounds)
+}
+
+// ReportStageMatch records a Swiss or round robin result, draws allowed.
+// The next Swiss round is paired as soon as the current one is done.
+func ReportStageMatch(db *mongo.Database, organizer User, tournamentID string, qualifier string, id string, scoreA int, scoreB int) (Stage, error) {
+	if !IsOrganizer(organizer) {
+		return Stage{}, errors.New("only organizers can report matches")
+	}
+	if scoreA < 0 || scoreB < 0 {
+		return Stage{}, errors.New("scores can't be negative")
+	}
+	for attempt := 0; attempt < reportAttempts; attempt++ {
+		var tournament Tournaments
+		err := db.Collection("Tournaments").FindOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID, "status": StatusLive}).Decode(&tournament)
+		if err != nil {
+			return Stage{}, errors.New("tournament is not live")
+		}
+		r, found := findRound(tournament, qualifier)
+		if !found || tournament.Rounds[r].Stage == nil {
+			return Stage{}, errors.New("round " + qualifier + " has no stage")
+		}
+		if tournament.Rounds[r].IsLocked {
+			return Stage{}, errors.New("round " + qualifier + " is locked")
+		}
+		stage := *tournament.Rounds[r].Stage
+		index := -1
+		for i := range stage.Matches {
+			if stage.Matches[i].MatchID == id {
+				index = i
+			}
+		}
+		if index < 0 || stage.Matches[index].Status != MatchReady {
+			return Stage{}, errors.New("match " + id + " is not waiting for a result")
+		}
+		match := &stage.Matches[index]
+		match.ScoreA, match.ScoreB, match.Status = scoreA, scoreB, MatchCompleted
+		if scoreA > scoreB {
+			match.Winner, match.Loser = match.TeamA, match.TeamB
+		} else if scoreB > scoreA {
+			match.Winner, match.Loser = match.TeamB, match.TeamA
+		}
+		if stage.Format == FormatSwiss && stage.CurrentRound < stage.Rounds && allPlayed(stage.Matches) {
+			pairSwissRound(&stage, tournament.Rounds[r].Slots)
+		}
+		stage.Table = stageTable(stage)
+
+		// like brackets, parallel pool matches must not overwrite each other
+		read := stage.Version
+		stage.Version++
+		roundPath := "rounds." + strconv.Itoa(r)
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{
+				"tournamentid":               tournamentID,
+				roundPath + ".qualifiername": qualifier,
+				roundPath + ".stage.version": versionIs(read),
+				roundPath + ".islocked":      bson.M{"$ne": true},
+			},
+			bson.M{"$set": bson.M{roundPath + ".stage": stage}})
+		if err != nil {
+			return Stage{}, err
+		}
+		if res.MatchedCount == 1 {
+			return stage, nil
+		}
+	}
+	return Stage{}, errors.New("the stage is busy, try again")
+}
+
+// GenerateStage sets up a Swiss or round robin round, seeded like
+// GenerateBracket
+func GenerateStage(db *mongo.Database, organizer User, tournamentID string, qualifier string, seeds []string) (Stage, error) {
+	if !IsOrganizer(organizer) {
+		return Stage{}, errors.New("only organizers can generate stages")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": tournamentID,
+		"status":       bson.M{"$in": []string{StatusRegistrationClosed, StatusLive}},
+	}).Decode(&tournament)
+	if err != nil {
+		return Stage{}, errors.New("tournament is not ready for stages")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return Stage{}, errors.New("no round " + qualifier)
+	}
+	if len(seeds) == 0 {
+		seeds = defaultSeeds(tournament, r)
+	}
+	seeds, err = checkSeeds(tournament, seeds)
+	if err != nil {
+		return Stage{}, err
+	}
+	round := tournament.Rounds[r]
+	stage, err := BuildStage(round.Format, seeds, round.NumberOfTeamsPerGroup, round.SwissRounds, round.Slots)
+	if err != nil {
+		return Stage{}, err
+	}
+	roundPath := "rounds." + strconv.Itoa(r)
+	filter := bson.M{
+		"tournamentid":               tournamentID,
+		roundPath + ".qualifiername": qualifier,
+		roundPath + ".islocked":      bson.M{"$ne": true},
+		roundPath + ".stage":         nil,
+	}
+	if round.Stage != nil {
+		if hasCompletedMatch(round.Stage.Matches) {
+			return Stage{}, errors.New("round " + qualifier + " already has results, the stage can't be generated again")
+		}
+		stage.Version = round.Stage.Version + 1
+		delete(filter, roundPath+".stage")
+		filter[roundPath+".stage.version"] = versionIs(round.Stage.Version)
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+		bson.M{"$set": bson.M{roundPath + ".stage": stage}})
+	if err != nil {
+		return Stage{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Stage{}, errors.New("round " + qualifier + " is locked or its stage changed")
+	}
+	return stage, nil
+}
+
+// StageView is a stage with the team names the frontend needs to show it
+type StageView struct {
+	Stage
+	TeamNames map[string]string
+}
+
+func GetStage(db *mongo.Database, tournamentID string, qualifier string) (StageView, bool) {
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found || tournament.Rounds[r].Stage == nil {
+		return StageView{}, false
+	}
+	view := StageView{Stage: *tournament.Rounds[r].Stage, TeamNames: map[string]string{}}
+	for _, team := range tournament.Teams {
+		view.TeamNames[team.TeamID] = team.TeamName
+	}
+	return view, true
+}
+
+// CanViewUpload tells whether a user may read an uploaded screenshot or
+// piece of evidence, organizers and the members of the team that sent it can
+func CanViewUpload(db *mongo.Database, requester User, path string) bool {
+	if path == "" {
+		return false
+	}
+	owners := []string{}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"rounds.groups.results.screenshots": path}).Decode(&tournament)
+	if err == nil {
+		for _, round := range tournament.Rounds {
+			for _, group := range round.Groups {
+				for _, result := range group.Results {
+					if containsString(result.Screenshots, path) {
+						owners = append(owners, result.TeamID)
+					}
+				}
+			}
+		}
+	}
+	var dispute Dispute
+	err = db.Collection("Disputes").FindOne(context.TODO(), bson.M{"$or": []bson.M{
+		{"evidence": path},
+		{"comments.evidence": path},
+	}}).Decode(&dispute)
+	if err == nil {
+		owners = append(owners, dispute.TeamID)
+	}
+	if len(owners) == 0 {
+		return false
+	}
+	if IsOrganizer(requester) {
+		return true
+	}
+	for _, teamid := range owners {
+		if team, found := GetTeamByID(db, teamid); found && isTeamMember(team, requester.User_uuid) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTeamMember(team Team, uuid string) bool {
+	for _, member := range team.UsersInTeam {
+		if member.User_uuid == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// RaiseDispute opens a dispute for the captain's team against a group or one
+// of its matches and freezes the group's standings
+func RaiseDispute(db *mongo.Database, requester User, dispute Dispute) (Dispute, error) {
+	if !CanEditTeam(db, requester, dispute.TeamID) {
+		return Dispute{}, errors.New("only the captain can raise a dispute")
+	}
+	if strings.TrimSpace(dispute.Reason) == "" {
+		return Dispute{}, errors.New("a dispute needs a reason")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": dispute.TournamentID, "status": StatusLive}).Decode(&tournament)
+	if err != nil {
+		return Dispute{}, errors.New("tournament is not live")
+	}
+	r, found := findRound(tournament, dispute.Qualifier)
+	if !found {
+		return Dispute{}, errors.New("no round " + dispute.Qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], dispute.GroupID)
+	if !found {
+		return Dispute{}, errors.New("no group " + dispute.GroupID + " in " + dispute.Qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	if !groupHasTeam(group, dispute.TeamID) {
+		return Dispute{}, errors.New("team " + dispute.TeamID + " is not in " + group.Group)
+	}
+	if dispute.MatchID != "" {
+		if _, found := findGroupMatch(group, dispute.MatchID); !found {
+			return Dispute{}, errors.New("no match " + dispute.MatchID + " in " + group.Group)
+		}
+	}
+
+	dispute.DisputeID = primitive.NewObjectID().Hex()
+	dispute.RaisedBy = requester.User_uuid
+	dispute.Comments = []DisputeComment{}
+	dispute.AssignedTo, dispute.Outcome, dispute.Resolution, dispute.ResolvedBy = "", "", "", ""
+	dispute.Status = "open"
+	dispute.CreatedAt = time.Now().UTC()
+	dispute.ResolvedAt = time.Time{}
+	if dispute.Evidence == nil {
+		dispute.Evidence = []string{}
+	}
+	_, err = db.Collection("Disputes").InsertOne(context.TODO(), dispute)
+	if err != nil {
+		return Dispute{}, err
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": dispute.TournamentID},
+		bson.M{"$inc": bson.M{"rounds.$[r].groups.$[g].opendisputes": 1}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"r.qualifiername": dispute.Qualifier},
+			bson.M{"g.groupid": dispute.GroupID},
+		}}))
+	if err != nil || res.ModifiedCount == 0 {
+		db.Collection("Disputes").DeleteOne(context.TODO(), bson.M{"disputeid": dispute.DisputeID})
+		return Dispute{}, errors.New("could not freeze " + group.Group + ", try again")
+	}
+	return dispute, nil
+}
+
+// CommentOnDispute adds to the thread of an open dispute, the raising team's
+// members and organizers can take part
+func CommentOnDispute(db *mongo.Database, requester User, disputeID string, message string, evidence []string) (Dispute, error) {
+	dispute, found := GetDispute(db, disputeID)
+	if !found {
+		return Dispute{}, errors.New("no dispute " + disputeID)
+	}
+	if !canSeeDispute(db, requester, dispute) {
+		return Dispute{}, errors.New("only the team and organizers can comment")
+	}
+	if strings.TrimSpace(message) == "" && len(evidence) == 0 {
+		return Dispute{}, errors.New("a comment needs a message or evidence")
+	}
+	if evidence == nil {
+		evidence = []string{}
+	}
+	comment := DisputeComment{
+		User_uuid: requester.User_uuid,
+		Message:   message,
+		Evidence:  evidence,
+		CreatedAt: time.Now().UTC(),
+	}
+	res, err := db.Collection("Disputes").UpdateOne(context.TODO(),
+		bson.M{"disputeid": disputeID, "status": "open"},
+		bson.M{"$push": bson.M{"comments": comment}})
+	if err != nil {
+		return Dispute{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Dispute{}, errors.New("dispute " + disputeID + " is closed")
+	}
+	dispute.Comments = append(dispute.Comments, comment)
+	return dispute, nil
+}
+
+// AssignDispute hands an open dispute to an organizer
+func AssignDispute(db *mongo.Database, requester User, disputeID string, assignee string) error {
+	if !IsOrganizer(requester) {
+		return errors.New("only organizers can assign disputes")
+	}
+	if !IsOrganizer(GetUserDetailsUUID(db, assignee)) {
+		return errors.New("disputes can only go to organizers")
+	}
+	res, err := db.Collection("Disputes").UpdateOne(context.TODO(),
+		bson.M{"disputeid": disputeID, "status": "open"},
+		bson.M{"$set": bson.M{"assignedto": assignee}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("dispute " + disputeID + " is not open")
+	}
+	CreateNotification(db, assignee, "Dispute "+disputeID+" has been assigned to you")
+	return nil
+}
+
+// ResolveDispute closes a dispute as amended, with the corrected results of
+// the disputed match, as penalty, issuing the penalty given, or as rejected.
+// The group's standings unfreeze once its last dispute is closed.
+func ResolveDispute(db *mongo.Database, organizer User, disputeID string, outcome string, resolution string, results []MatchResult, penalty Penalty) (Dispute, error) {
+	if !IsOrganizer(organizer) {
+		return Dispute{}, errors.New("only organizers can resolve disputes")
+	}
+	if outcome != "amended" && outcome != "penalty" && outcome != "rejected" {
+		return Dispute{}, errors.New("outcome must be amended, penalty or rejected")
+	}
+	dispute, found := GetDispute(db, disputeID)
+	if !found || dispute.Status != "open" {
+		return Dispute{}, errors.New("dispute " + disputeID + " is not open")
+	}
+	if dispute.AssignedTo != "" && dispute.AssignedTo != organizer.User_uuid && !IsAdmin(organizer) {
+		return Dispute{}, errors.New("dispute " + disputeID + " is assigned to another organizer")
+	}
+	if outcome == "amended" && (dispute.MatchID == "" || len(results) == 0) {
+		return Dispute{}, errors.New("amending needs the disputed match and its corrected results")
+	}
+
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(),
+		bson.M{"tournamentid": dispute.TournamentID}).Decode(&tournament)
+	if err != nil {
+		return Dispute{}, err
+	}
+	r, found := findRound(tournament, dispute.Qualifier)
+	if !found {
+		return Dispute{}, errors.New("no round " + dispute.Qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], dispute.GroupID)
+	if !found {
+		return Dispute{}, errors.New("no group " + dispute.GroupID + " in " + dispute.Qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	if outcome == "amended" {
+		group, err = withMatchResults(tournament, r, group, dispute.MatchID, results)
+		if err != nil {
+			return Dispute{}, err
+		}
+	}
+
+	// closing the dispute first means only one organizer gets to apply it
+	closed := bson.M{
+		"status":     "resolved",
+		"outcome":    outcome,
+		"resolution": resolution,
+		"resolvedby": organizer.User_uuid,
+		"resolvedat": time.Now().UTC(),
+	}
+	res, err := db.Collection("Disputes").UpdateOne(context.TODO(),
+		bson.M{"disputeid": disputeID, "status": "open"}, bson.M{"$set": closed})
+	if err != nil {
+		return Dispute{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Dispute{}, errors.New("dispute " + disputeID + " was already resolved")
+	}
+	reopen := func() {
+		db.Collection("Disputes").UpdateOne(context.TODO(),
+			bson.M{"disputeid": disputeID},
+			bson.M{"$set": bson.M{"status": "open", "outcome": "", "resolution": "", "resolvedby": "", "resolvedat": time.Time{}}})
+	}
+
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	filter := bson.M{"tournamentid": dispute.TournamentID, groupPath + ".groupid": dispute.GroupID}
+	update := bson.M{"$inc": bson.M{groupPath + ".opendisputes": -1}}
+	if outcome == "amended" {
+		filter[groupPath+".version"] = versionIs(group.Version)
+		update["$inc"] = bson.M{groupPath + ".opendisputes": -1, groupPath + ".version": 1}
+		update["$set"] = bson.M{
+			groupPath + ".rounds":    group.Rounds,
+			groupPath + ".standings": group.Standings,
+		}
+	}
+	res, err = db.Collection("Tournaments").UpdateOne(context.TODO(), filter, update)
+	if err != nil || res.MatchedCount == 0 {
+		reopen()
+		return Dispute{}, errors.New(group.Group + " changed, try again")
+	}
+
+	// the penalty notifies the team, so it only goes out once the dispute
+	// is settled
+	if outcome == "penalty" {
+		penalty.TournamentID = dispute.TournamentID
+		penalty.DisputeID = dispute.DisputeID
+		if penalty.Reason == "" {
+			penalty.Reason = resolution
+		}
+		if _, err := IssuePenalty(db, organizer, penalty); err != nil {
+			db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{"tournamentid": dispute.TournamentID, groupPath + ".groupid": dispute.GroupID},
+				bson.M{"$inc": bson.M{groupPath + ".opendisputes": 1}})
+			reopen()
+			return Dispute{}, err
+		}
+	}
+
+	dispute, _ = GetDispute(db, disputeID)
+	if team, found := GetTeamByID(db, dispute.TeamID); found {
+		notifyTeam(db, team, "Your dispute in "+tournament.Title+" was resolved: "+outcome)
+	}
+	return dispute, nil
+}
+
+// canSeeDispute is true for organizers and the members of the team that
+// raised the dispute
+func canSeeDispute(db *mongo.Database, requester User, dispute Dispute) bool {
+	if IsOrganizer(requester) {
+		return true
+	}
+	team, found := GetTeamByID(db, dispute.TeamID)
+	return found && isTeamMember(team, requester.User_uuid)
+}
+
+// ViewDispute hands a dispute with its thread to whoever can comment on it
+func ViewDispute(db *mongo.Database, requester User, disputeID string) (Dispute, error) {
+	dispute, found := GetDispute(db, disputeID)
+	if !found || !canSeeDispute(db, requester, dispute) {
+		return Dispute{}, errors.New("no dispute " + disputeID)
+	}
+	return dispute, nil
+}
+
+func GetDispute(db *mongo.Database, disputeID string) (Dispute, bool) {
+	var dispute Dispute
+	err := db.Collection("Disputes").FindOne(context.TODO(),
+		bson.M{"disputeid": disputeID}).Decode(&dispute)
+	if err != nil {
+		return Dispute{}, false
+	}
+	return dispute, true
+}
+
+// GetDisputes lists a tournament's disputes, newest first, optionally only
+// the open or resolved ones. Organizers see all of them, players only the
+// ones raised by their teams.
+func GetDisputes(db *mongo.Database, requester User, tournamentID string, status string) []Dispute {
+	disputes := []Dispute{}
+	filter := bson.M{"tournamentid": tournamentID}
+	if status != "" {
+		filter["status"] = status
+	}
+	if !IsOrganizer(requester) {
+		teamids := []string{}
+		res, err := db.Collection("Teams").Find(context.TODO(),
+			bson.M{"usersinteam.user_uuid": requester.User_uuid})
+		if err != nil {
+			log.Println(err)
+			return disputes
+		}
+		for res.Next(context.TODO()) {
+			var team Team
+			res.Decode(&team)
+			teamids = append(teamids, team.TeamID)
+		}
+		filter["teamid"] = bson.M{"$in": teamids}
+	}
+	res, err := db.Collection("Disputes").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.M{"createdat": -1}))
+	if err != nil {
+		log.Println(err)
+		return disputes
+	}
+	for res.Next(context.TODO()) {
+		var dispute Dispute
+		res.Decode(&dispute)
+		disputes = append(disputes, dispute)
+	}
+	return disputes
+}
+
+// IssuePenalty sanctions a registered team, or one of its players when
+// User_uuid is set. Deductions come off the team's points in a group,
+// forfeits score the team nothing in a match, or in the whole group without
+// a MatchID, and disqualifications rank the team last, keep it from
+// qualifying and from prizes.
+func IssuePenalty(db *mongo.Database, organizer User, penalty Penalty) (Penalty, error) {
+	if !IsOrganizer(organizer) {
+		return Penalty{}, errors.New("only organizers can issue penalties")
+	}
+	if strings.TrimSpace(penalty.Reason) == "" {
+		return Penalty{}, errors.New("a penalty needs a reason")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": penalty.TournamentID,
+		"status":       bson.M{"$in": []string{StatusRegistrationClosed, StatusLive, StatusCompleted}},
+	}).Decode(&tournament)
+	if err != nil {
+		return Penalty{}, errors.New("tournament has not started")
+	}
+	team, found := registeredTeam(tournament, penalty.TeamID)
+	if !found {
+		return Penalty{}, errors.New("team " + penalty.TeamID + " is not registered")
+	}
+	if penalty.User_uuid != "" && !isTeamMember(team, penalty.User_uuid) {
+		return Penalty{}, errors.New("player " + penalty.User_uuid + " is not on team " + team.TeamID)
+	}
+
+	switch penalty.Kind {
+	case "deduction", "forfeit":
+		r, found := findRound(tournament, penalty.Qualifier)
+		if !found {
+			return Penalty{}, errors.New("no round " + penalty.Qualifier)
+		}
+		g, found := findGroup(tournament.Rounds[r], penalty.GroupID)
+		if !found || !groupHasTeam(tournament.Rounds[r].Groups[g], penalty.TeamID) {
+			return Penalty{}, errors.New("team " + penalty.TeamID + " is not in group " + penalty.GroupID)
+		}
+		if penalty.Kind == "deduction" && penalty.Points <= 0 {
+			return Penalty{}, errors.New("a deduction needs points to take off")
+		}
+		if penalty.Kind == "forfeit" && penalty.MatchID != "" {
+			if _, found := findGroupMatch(tournament.Rounds[r].Groups[g], penalty.MatchID); !found {
+				return Penalty{}, errors.New("no match " + penalty.MatchID + " in group " + penalty.GroupID)
+			}
+		}
+		if penalty.Kind == "forfeit" {
+			penalty.Points = 0
+		}
+	case "disqualification":
+		penalty.Qualifier, penalty.GroupID, penalty.MatchID, penalty.Points = "", "", "", 0
+	default:
+		return Penalty{}, errors.New("penalty must be a deduction, forfeit or disqualification")
+	}
+
+	penalty.IssuedBy = organizer.User_uuid
+	penalty, err = recordPenalty(db, penalty)
+	if err != nil {
+		return Penalty{}, err
+	}
+	notifyTeam(db, team, "Your team was given a "+penalty.Kind+" in "+tournament.Title+": "+penalty.Reason)
+	return penalty, nil
+}
+
+// recordPenalty stores a penalty that has already been checked
+func recordPenalty(db *mongo.Database, penalty Penalty) (Penalty, error) {
+	penalty.PenaltyID = primitive.NewObjectID().Hex()
+	penalty.IssuedAt = time.Now().UTC()
+	penalty.Reversed, penalty.ReversedBy, penalty.ReversedAt, penalty.ReversalNote = false, "", time.Time{}, ""
+	_, err := db.Collection("Penalties").InsertOne(context.TODO(), penalty)
+	if err != nil {
+		return Penalty{}, err
+	}
+	return penalty, nil
+}
+
+// ReversePenalty undoes a penalty, the record stays with who reversed it
+func ReversePenalty(db *mongo.Database, organizer User, penaltyID string, note string) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can reverse penalties")
+	}
+	res, err := db.Collection("Penalties").UpdateOne(context.TODO(),
+		bson.M{"penaltyid": penaltyID, "reversed": false},
+		bson.M{"$set": bson.M{
+			"reversed":     true,
+			"reversedby":   organizer.User_uuid,
+			"reversedat":   time.Now().UTC(),
+			"reversalnote": note,
+		}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("penalty " + penaltyID + " is not in force")
+	}
+	return nil
+}
+
+// GetPenalties is a tournament's penalty log, reversed ones included
+func GetPenalties(db *mongo.Database, tournamentID string) []Penalty {
+	return findPenalties(db, bson.M{"tournamentid": tournamentID})
+}
+
+func activePenalties(db *mongo.Database, tournamentID string) []Penalty {
+	return findPenalties(db, bson.M{"tournamentid": tournamentID, "reversed": false})
+}
+
+func findPenalties(db *mongo.Database, filter bson.M) []Penalty {
+	penalties := []Penalty{}
+	res, err := db.Collection("Penalties").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.M{"issuedat": 1}))
+	if err != nil {
+		log.Println(err)
+		return penalties
+	}
+	for res.Next(context.TODO()) {
+		var penalty Penalty
+		res.Decode(&penalty)
+		penalties = append(penalties, penalty)
+	}
+	return penalties
+}
+
+// IsDisqualified tells whether a team, or a player when uuid is set, is
+// disqualified from the tournament
+func IsDisqualified(db *mongo.Database, tournamentID string, teamid string, uuid string) bool {
+	filter := bson.M{"tournamentid": tournamentID, "kind": "disqualification", "reversed": false}
+	if uuid != "" {
+		filter["user_uuid"] = uuid
+	} else {
+		filter["teamid"] = teamid
+		filter["user_uuid"] = ""
+	}
+	count, err := db.Collection("Penalties").CountDocuments(context.TODO(), filter)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return count > 0
+}
+
+// playerBannedForTeam is true when the player is disqualified from a running
+// tournament the team is registered in
+func playerBannedForTeam(db *mongo.Database, uuid string, teamid string) bool {
+	tournamentIDs := []string{}
+	for _, penalty := range findPenalties(db, bson.M{"user_uuid": uuid, "kind": "disqualification", "reversed": false}) {
+		tournamentIDs = append(tournamentIDs, penalty.TournamentID)
+	}
+	if len(tournamentIDs) == 0 {
+		return false
+	}
+	count, err := db.Collection("Tournaments").CountDocuments(context.TODO(), bson.M{
+		"tournamentid": bson.M{"$in": tournamentIDs},
+		"teams.teamid": teamid,
+		"status":       bson.M{"$nin": []string{StatusCompleted, StatusCancelled}},
+	})
+	if err != nil {
+		log.Println(err)
+		return true
+	}
+	return count > 0
+}
+
+// penalizedTable is the group's table with forfeits, deductions and
+// disqualifications applied
+func penalizedTable(group Groups, table PointTable, penalties []Penalty) []Standing {
+	forfeited := map[string]bool{}
+	forfeitedGroup := map[string]bool{}
+	for _, penalty := range penalties {
+		if penalty.Kind == "forfeit" && penalty.GroupID == group.GroupID {
+			forfeited[penalty.MatchID+"|"+penalty.TeamID] = true
+			if penalty.MatchID == "" {
+				forfeitedGroup[penalty.TeamID] = true
+			}
+		}
+	}
+	standings := groupTable(group, table.TieBreakers)
+	if len(forfeited) > 0 {
+		matches := []Match{}
+		for _, match := range group.Rounds {
+			results := []MatchResult{}
+			for _, result := range match.Results {
+				if forfeited[match.MatchID+"|"+result.TeamID] || forfeitedGroup[result.TeamID] {
+					result = MatchResult{TeamID: result.TeamID}
+				}
+				results = append(results, result)
+			}
+			match.Results = results
+			matches = append(matches, match)
+		}
+		group.Rounds = matches
+		standings = computeGroupStandings(group, table)
+	}
+
+	lines := map[string]*Standing{}
+	for i := range standings {
+		lines[standings[i].TeamID] = &standings[i]
+	}
+	for _, penalty := range penalties {
+		line, ok := lines[penalty.TeamID]
+		if !ok {
+			continue
+		}
+		switch {
+		case penalty.Kind == "deduction" && penalty.GroupID == group.GroupID:
+			line.Points -= penalty.Points
+			line.Deducted += penalty.Points
+		case penalty.Kind == "disqualification" && penalty.User_uuid == "":
+			line.Disqualified = true
+		case penalty.Kind == "forfeit" && penalty.GroupID == group.GroupID && penalty.MatchID == "":
+			line.Disqualified = true
+		}
+	}
+	return rankStandingsBy(standings, table.TieBreakers)
+}
+
+// applyPenalties is a copy of the tournament whose battle royale groups carry
+// their penalized tables
+func applyPenalties(tournament Tournaments, penalties []Penalty) Tournaments {
+	table := scoringFor(tournament)
+	rounds := make([]Rounds, len(tournament.Rounds))
+	for r, round := range tournament.Rounds {
+		groups := make([]Groups, len(round.Groups))
+		for g, group := range round.Groups {
+			group.Standings = penalizedTable(group, table, penalties)
+			groups[g] = group
+		}
+		round.Groups = groups
+		rounds[r] = round
+	}
+	tournament.Rounds = rounds
+	return tournament
+}
+
+func validPrizeSplit(pool int, split []int) bool {
+	if pool < 0 {
+		return false
+	}
+	total := 0
+	for _, percent := range split {
+		if percent < 0 {
+			return false
+		}
+		total += percent
+	}
+	return total <= 100
+}
+
+// GetPrizes shares the prize pool out by the finalized results, or by the
+// last battle royale round's standings before they are finalized.
+// Disqualified teams get nothing and everyone below them moves up.
+func GetPrizes(db *mongo.Database, tournamentID string) (PrizeDistribution, bool) {
+	tournament := GetTournament(db, tournamentID)
+	if tournament.TournamentID == "" {
+		return PrizeDistribution{}, false
+	}
+	distribution := PrizeDistribution{PrizePool: tournament.PrizePool, Lines: []PrizeLine{}}
+	penalties := activePenalties(db, tournamentID)
+	disqualified := map[string]bool{}
+	for _, penalty := range penalties {
+		if penalty.Kind == "disqualification" && penalty.User_uuid == "" {
+			disqualified[penalty.TeamID] = true
+		}
+	}
+
+	order := []string{}
+	res, err := db.Collection("TournamentResults").Find(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "placement": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "placement", Value: 1}, {Key: "teamid", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		return distribution, true
+	}
+	for res.Next(context.TODO()) {
+		var result TournamentResult
+		res.Decode(&result)
+		order = append(order, result.TeamID)
+	}
+	distribution.Source = "results"
+	if len(order) == 0 {
+		distribution.Source = "standings"
+		for r := len(tournament.Rounds) - 1; r >= 0 && len(order) == 0; r-- {
+			if len(tournament.Rounds[r].Groups) == 0 {
+				continue
+			}
+			view, _ := GetStandings(db, tournamentID, tournament.Rounds[r].QualifierName)
+			for _, standing := range view.Overall {
+				order = append(order, standing.TeamID)
+			}
+		}
+	}
+
+	names := map[string]string{}
+	for _, team := range tournament.Teams {
+		names[team.TeamID] = team.TeamName
+	}
+	placement := 0
+	for _, teamid := range order {
+		if disqualified[teamid] {
+			continue
+		}
+		if placement >= len(tournament.PrizeSplit) {
+			break
+		}
+		distribution.Lines = append(distribution.Lines, PrizeLine{
+			Placement: placement + 1,
+			TeamID:    teamid,
+			TeamName:  names[teamid],
+			Amount:    tournament.PrizePool * tournament.PrizeSplit[placement] / 100,
+		})
+		placement++
+	}
+	return distribution, true
+}
+
+// defaultRoomRevealMinutes is used when the tournament does not set
+// RoomRevealMinutes
+const defaultRoomRevealMinutes = 15
+
+func roomRevealLead(tournament Tournaments) time.Duration {
+	minutes := tournament.RoomRevealMinutes
+	if minutes <= 0 {
+		minutes = defaultRoomRevealMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// teamOfMember is the team among teams the user plays for
+func teamOfMember(teams []Team, uuid string) (Team, bool) {
+	for _, team := range teams {
+		if isTeamMember(team, uuid) {
+			return team, true
+		}
+	}
+	return Team{}, false
+}
+
+// SetRoomCredentials sets or rotates a group's room, members who could
+// already see the old ones are told they changed
+func SetRoomCredentials(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, roomID string, password string) (RoomCredentials, error) {
+	if !IsOrganizer(organizer) {
+		return RoomCredentials{}, errors.New("only organizers can set room credentials")
+	}
+	if roomID == "" {
+		return RoomCredentials{}, errors.New("a room needs an id")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOneAndUpdate(context.TODO(),
+		bson.M{"tournamentid": tournamentID, "status": bson.M{"$nin": []string{StatusCompleted, StatusCancelled}}},
+		bson.M{
+			"$set": bson.M{
+				"rounds.$[r].groups.$[g].roomid":   roomID,
+				"rounds.$[r].groups.$[g].password": password,
+			},
+			"$inc": bson.M{"rounds.$[r].groups.$[g].roomversion": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).
+			SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"r.qualifiername": qualifier},
+				bson.M{"g.groupid": groupid},
+			}})).Decode(&tournament)
+	if err != nil {
+		return RoomCredentials{}, errors.New("tournament is over or has no such round")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return RoomCredentials{}, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return RoomCredentials{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	if group.RoomVersion > 1 && !time.Now().Before(group.StartingAt.Add(-roomRevealLead(tournament))) {
+		for _, team := range group.Teams {
+			notifyTeam(db, team, "The room for "+group.Group+" in "+tournament.Title+" has changed, check the new credentials")
+		}
+	}
+	return RoomCredentials{
+		GroupID:    group.GroupID,
+		Group:      group.Group,
+		RoomID:     group.RoomID,
+		Password:   group.Password,
+		Version:    group.RoomVersion,
+		StartingAt: group.StartingAt,
+	}, nil
+}
+
+// GetRoomCredentials hands a group's room to the players of its teams from
+// RoomRevealMinutes before the group starts, organizers can always read it.
+// Every read is recorded.
+func GetRoomCredentials(db *mongo.Database, requester User, tournamentID string, qualifier string, groupid string) (RoomCredentials, error) {
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return RoomCredentials{}, errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return RoomCredentials{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	view := CredentialView{
+		TournamentID: tournamentID,
+		Qualifier:    qualifier,
+		GroupID:      groupid,
+		User_uuid:    requester.User_uuid,
+		Version:      group.RoomVersion,
+		ViewedAt:     time.Now().UTC(),
+	}
+	if !IsOrganizer(requester) {
+		team, found := teamOfMember(group.Teams, requester.User_uuid)
+		if !found {
+			return RoomCredentials{}, errors.New("only players in " + group.Group + " can see its room")
+		}
+		if group.StartingAt.IsZero() {
+			return RoomCredentials{}, errors.New(group.Group + " has no start time yet")
+		}
+		revealAt := group.StartingAt.Add(-roomRevealLead(tournament))
+		if time.Now().Before(revealAt) {
+			return RoomCredentials{}, errors.New("the room is shown from " + revealAt.In(TournamentLocation(tournament)).Format(time.RFC3339))
+		}
+		view.TeamID = team.TeamID
+	}
+	if group.RoomID == "" {
+		return RoomCredentials{}, errors.New("the room for " + group.Group + " is not set yet")
+	}
+	_, err := db.Collection("CredentialViews").InsertOne(context.TODO(), view)
+	if err != nil {
+		log.Println(err)
+		return RoomCredentials{}, errors.New("could not record the view, try again")
+	}
+	return RoomCredentials{
+		GroupID:    group.GroupID,
+		Group:      group.Group,
+		RoomID:     group.RoomID,
+		Password:   group.Password,
+		Version:    group.RoomVersion,
+		StartingAt: group.StartingAt,
+	}, nil
+}
+
+// GetCredentialViews is the audit of who read a tournament's rooms, newest
+// first, narrowed to a group when groupid is set
+func GetCredentialViews(db *mongo.Database, organizer User, tournamentID string, groupid string) ([]CredentialView, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can see who viewed the rooms")
+	}
+	views := []CredentialView{}
+	filter := bson.M{"tournamentid": tournamentID}
+	if groupid != "" {
+		filter["groupid"] = groupid
+	}
+	res, err := db.Collection("CredentialViews").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.M{"viewedat": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for res.Next(context.TODO()) {
+		var view CredentialView
+		res.Decode(&view)
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// defaultCheckInCloseMinutes leaves time to replace no-shows before a group
+// starts
+const defaultCheckInCloseMinutes = 10
+
+func validCheckIn(tournament Tournaments) bool {
+	if tournament.NoShowPolicy != "" && tournament.NoShowPolicy != "forfeit" && tournament.NoShowPolicy != "replace" {
+		return false
+	}
+	if tournament.CheckInMinutes < 0 || tournament.CheckInCloseMinutes < 0 {
+		return false
+	}
+	if tournament.CheckInMinutes == 0 {
+		return true
+	}
+	opensAt, closesAt := checkInWindow(tournament, Groups{})
+	return opensAt.Before(closesAt)
+}
+
+// checkInWindow is when the group's captains can check in
+func checkInWindow(tournament Tournaments, group Groups) (time.Time, time.Time) {
+	closeMinutes := tournament.CheckInCloseMinutes
+	if closeMinutes <= 0 {
+		closeMinutes = defaultCheckInCloseMinutes
+	}
+	opensAt := group.StartingAt.Add(-time.Duration(tournament.CheckInMinutes) * time.Minute)
+	closesAt := group.StartingAt.Add(-time.Duration(closeMinutes) * time.Minute)
+	return opensAt, closesAt
+}
+
+// CheckIn confirms the captain's team will play its group, only while the
+// group's check-in window is open
+func CheckIn(db *mongo.Database, requester User, tournamentID string, qualifier string, groupid string, teamid string) error {
+	if !CanEditTeam(db, requester, teamid) {
+		return errors.New("only the captain can check the team in")
+	}
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": tournamentID,
+		"status":       bson.M{"$in": []string{StatusRegistrationClosed, StatusLive}},
+	}).Decode(&tournament)
+	if err != nil {
+		return errors.New("tournament is not running")
+	}
+	if tournament.CheckInMinutes <= 0 {
+		return errors.New("this tournament has no check-in")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return errors.New("no round " + qualifier)
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	if !groupHasTeam(group, teamid) {
+		return errors.New("team " + teamid + " is not in " + group.Group)
+	}
+	opensAt, closesAt := checkInWindow(tournament, group)
+	now := time.Now()
+	if group.StartingAt.IsZero() || now.Before(opensAt) || !now.Before(closesAt) {
+		location := TournamentLocation(tournament)
+		return errors.New("check-in for " + group.Group + " is open from " + opensAt.In(location).Format(time.RFC3339) +
+			" to " + closesAt.In(location).Format(time.RFC3339))
+	}
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":                  tournamentID,
+			groupPath + ".groupid":          groupid,
+			groupPath + ".teams.teamid":     teamid,
+			groupPath + ".checkinprocessed": bson.M{"$ne": true},
+		},
+		bson.M{"$addToSet": bson.M{groupPath + ".checkedin": teamid}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("check-in for " + group.Group + " has closed")
+	}
+	return nil
+}
+
+// ProcessCheckIns deals with the teams that missed check-in of every group
+// whose window has closed, RunSchedules calls it
+func ProcessCheckIns(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{
+		"status":         bson.M{"$in": []string{StatusRegistrationClosed, StatusLive}},
+		"checkinminutes": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	now := time.Now()
+	for res.Next(context.TODO()) {
+		var tournament Tournaments
+		res.Decode(&tournament)
+		for r, round := range tournament.Rounds {
+			for g, group := range round.Groups {
+				if group.CheckInProcessed || group.StartingAt.IsZero() || len(group.Teams) == 0 {
+					continue
+				}
+				if _, closesAt := checkInWindow(tournament, group); now.Before(closesAt) {
+					continue
+				}
+				// claiming the group first keeps two runs from handling it twice
+				groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+				claimed, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+					bson.M{
+						"tournamentid":                  tournament.TournamentID,
+						groupPath + ".groupid":          group.GroupID,
+						groupPath + ".checkinprocessed": bson.M{"$ne": true},
+					},
+					bson.M{"$set": bson.M{groupPath + ".checkinprocessed": true}})
+				if err != nil || claimed.ModifiedCount == 0 {
+					continue
+				}
+				handleNoShows(db, tournament, r, g)
+			}
+		}
+	}
+}
+
+// handleNoShows forfeits the group for every team that did not check in, or
+// hands its place to the first team on the waitlist. Only the first round
+// takes replacements, later rounds are played by the teams that qualified.
+func handleNoShows(db *mongo.Database, tournament Tournaments, r int, g int) {
+	round := tournament.Rounds[r]
+	group := round.Groups[g]
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	for _, team := range group.Teams {
+		if containsString(group.CheckedIn, team.TeamID) {
+			continue
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{"tournamentid": tournament.TournamentID, groupPath + ".groupid": group.GroupID},
+			bson.M{"$addToSet": bson.M{groupPath + ".noshows": team.TeamID}})
+		if err != nil {
+			log.Println(err)
+		}
+		if tournament.NoShowPolicy == "replace" && r == 0 {
+			if replacement, ok := replaceNoShow(db, tournament.TournamentID, r, g, team); ok {
+				notifyTeam(db, team, "Team "+team.TeamName+" missed check-in for "+group.Group+" in "+
+					tournament.Title+", its place went to "+replacement.TeamName)
+				continue
+			}
+		}
+		_, err = recordPenalty(db, Penalty{
+			TournamentID: tournament.TournamentID,
+			Kind:         "forfeit",
+			TeamID:       team.TeamID,
+			Qualifier:    round.QualifierName,
+			GroupID:      group.GroupID,
+			Reason:       "did not check in",
+			IssuedBy:     "check-in",
+		})
+		if err != nil {
+			log.Println(err)
+		}
+		notifyTeam(db, team, "Team "+team.TeamName+" missed check-in for "+group.Group+" in "+tournament.Title+" and forfeits it")
+	}
+}
+
+// replaceNoShow gives the no-show's place in the tournament and its group
+// to the first team on the waitlist that may still register, charged like
+// any other promotion
+func replaceNoShow(db *mongo.Database, tournamentID string, r int, g int, noShow Team) (Team, bool) {
+	roundPath := "rounds." + strconv.Itoa(r)
+	groupPath := roundPath + ".groups." + strconv.Itoa(g)
+	for {
+		var tournament Tournaments
+		err := db.Collection("Tournaments").FindOne(context.TODO(),
+			bson.M{"tournamentid": tournamentID}).Decode(&tournament)
+		if err != nil || len(tournament.Waitlist) == 0 || r >= len(tournament.Rounds) || g >= len(tournament.Rounds[r].Groups) {
+			return Team{}, false
+		}
+		slot, entry := -1, -1
+		for i, team := range tournament.Rounds[r].Groups[g].Teams {
+			if team.TeamID == noShow.TeamID {
+				slot = i
+			}
+		}
+		for i, team := range tournament.Teams {
+			if team.TeamID == noShow.TeamID {
+				entry = i
+			}
+		}
+		if slot < 0 || entry < 0 {
+			return Team{}, false
+		}
+		next := tournament.Waitlist[0]
+		if problem := registrationProblem(db, tournament, next); problem != nil {
+			// the team can no longer play here, it gives way to the next one
+			res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{"tournamentid": tournamentID, "waitlist.0.teamid": next.TeamID},
+				bson.M{"$pop": bson.M{"waitlist": -1}})
+			if err != nil {
+				return Team{}, false
+			}
+			if res.ModifiedCount == 1 {
+				notifyTeam(db, next, "Team "+next.TeamName+" left the waitlist of "+tournament.Title+": "+problem.Error())
+			}
+			continue
+		}
+
+		// the no-show leaves the entries and the group in the same update
+		// that brings the replacement in
+		slotPath := groupPath + ".teams." + strconv.Itoa(slot)
+		entryPath := "teams." + strconv.Itoa(entry)
+		res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+			bson.M{
+				"tournamentid":        tournamentID,
+				"waitlist.0.teamid":   next.TeamID,
+				slotPath + ".teamid":  noShow.TeamID,
+				entryPath + ".teamid": noShow.TeamID,
+			},
+			bson.M{
+				"$pop":  bson.M{"waitlist": -1},
+				"$push": bson.M{groupPath + ".checkedin": next.TeamID},
+				"$set":  bson.M{slotPath: next, entryPath: next},
+				"$inc":  bson.M{roundPath + ".version": 1},
+			})
+		if err != nil || res.ModifiedCount == 0 {
+			return Team{}, false
+		}
+		if !chargeEntranceFee(db, tournament, next) {
+			db.Collection("Tournaments").UpdateOne(context.TODO(),
+				bson.M{
+					"tournamentid":        tournamentID,
+					slotPath + ".teamid":  next.TeamID,
+					entryPath + ".teamid": next.TeamID,
+				},
+				bson.M{
+					"$pull": bson.M{groupPath + ".checkedin": next.TeamID},
+					"$set":  bson.M{slotPath: noShow, entryPath: noShow},
+					"$inc":  bson.M{roundPath + ".version": 1},
+				})
+			notifyTeam(db, next, "Team "+next.TeamName+" could not pay the entrance fee for "+
+				tournament.Title+" and left the waitlist")
+			continue
+		}
+		notifyTeam(db, next, "Team "+next.TeamName+" takes "+noShow.TeamName+"'s place in "+
+			tournament.Rounds[r].Groups[g].Group+" of "+tournament.Title+", the group starts soon")
+		return next, true
+	}
+}
+
+// GetCheckInDashboard shows the organizer where every group of a round is
+// with check-in
+func GetCheckInDashboard(db *mongo.Database, organizer User, tournamentID string, qualifier string) ([]GroupCheckIn, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can see check-ins")
+	}
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return nil, errors.New("no round " + qualifier)
+	}
+	now := time.Now()
+	dashboard := []GroupCheckIn{}
+	for _, group := range tournament.Rounds[r].Groups {
+		opensAt, closesAt := checkInWindow(tournament, group)
+		line := GroupCheckIn{
+			GroupID:    group.GroupID,
+			Group:      group.Group,
+			StartingAt: group.StartingAt,
+			OpensAt:    opensAt,
+			ClosesAt:   closesAt,
+			State:      "open",
+			Teams:      []TeamCheckIn{},
+		}
+		switch {
+		case group.CheckInProcessed || !now.Before(closesAt):
+			line.State = "closed"
+		case group.StartingAt.IsZero() || now.Before(opensAt):
+			line.State = "upcoming"
+		}
+		for _, team := range group.Teams {
+			checkedIn := containsString(group.CheckedIn, team.TeamID)
+			if checkedIn {
+				line.CheckedIn++
+			}
+			line.Teams = append(line.Teams, TeamCheckIn{
+				TeamID:    team.TeamID,
+				TeamName:  team.TeamName,
+				CheckedIn: checkedIn,
+				NoShow:    containsString(group.NoShows, team.TeamID),
+			})
+		}
+		dashboard = append(dashboard, line)
+	}
+	return dashboard, nil
+}
+
+func validMatchTemplate(template MatchTemplate) bool {
+	return template.Matches > 0 && template.Duration > 0 && template.Break >= 0
+}
+
+// BuildMatches is a group's schedule from the template, the first match
+// starts with the group
+func BuildMatches(template MatchTemplate, mapName string, startingAt time.Time) []Match {
+	matches := []Match{}
+	step := time.Duration(template.Duration+template.Break) * time.Minute
+	for i := 0; i < template.Matches; i++ {
+		matchMap := mapName
+		if len(template.Maps) > 0 {
+			matchMap = template.Maps[i%len(template.Maps)]
+		}
+		matches = append(matches, Match{
+			MatchID:    primitive.NewObjectID().Hex(),
+			Title:      "Match " + strconv.Itoa(i+1),
+			StartingAt: startingAt.Add(time.Duration(i) * step),
+			Duration:   template.Duration,
+			MapName:    matchMap,
+			Status:     MatchScheduled,
+		})
+	}
+	return matches
+}
+
+// scheduleRound finds a battle royale round of a tournament that has not
+// finished yet
+func scheduleRound(db *mongo.Database, tournamentID string, qualifier string) (Tournaments, int, error) {
+	var tournament Tournaments
+	err := db.Collection("Tournaments").FindOne(context.TODO(), bson.M{
+		"tournamentid": tournamentID,
+		"status":       bson.M{"$nin": []string{StatusCompleted, StatusCancelled}},
+	}).Decode(&tournament)
+	if err != nil {
+		return Tournaments{}, -1, errors.New("tournament is over or does not exist")
+	}
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return Tournaments{}, -1, errors.New("no round " + qualifier)
+	}
+	if format := tournament.Rounds[r].Format; format != "" && format != FormatBattleRoyale {
+		return Tournaments{}, -1, errors.New(qualifier + " is not a battle royale round")
+	}
+	return tournament, r, nil
+}
+
+// ScheduleMatches replaces the matches of a group, or of every group in the
+// round when groupid is empty, with the template's schedule. Groups that
+// already have results keep their matches, those are edited one by one.
+func ScheduleMatches(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, template MatchTemplate) ([]Groups, error) {
+	if !IsOrganizer(organizer) {
+		return nil, errors.New("only organizers can schedule matches")
+	}
+	if !validMatchTemplate(template) {
+		return nil, errors.New("a template needs at least one match, a duration and no negative break")
+	}
+	tournament, r, err := scheduleRound(db, tournamentID, qualifier)
+	if err != nil {
+		return nil, err
+	}
+	round := tournament.Rounds[r]
+	roundPath := "rounds." + strconv.Itoa(r)
+	filter := bson.M{"tournamentid": tournamentID, roundPath + ".qualifiername": qualifier}
+	set := bson.M{roundPath + ".matchtemplate": template}
+	scheduled := []Groups{}
+	for g, group := range round.Groups {
+		if groupid != "" && group.GroupID != groupid {
+			continue
+		}
+		for _, match := range group.Rounds {
+			if len(match.Results) > 0 {
+				return nil, errors.New(group.Group + " already has results")
+			}
+		}
+		if group.StartingAt.IsZero() {
+			return nil, errors.New(group.Group + " has no start time")
+		}
+		// the group has to be the version we read, so results entered in the
+		// meantime are not thrown away
+		groupPath := roundPath + ".groups." + strconv.Itoa(g)
+		filter[groupPath+".groupid"] = group.GroupID
+		filter[groupPath+".version"] = versionIs(group.Version)
+		group.Rounds = BuildMatches(template, round.MapName, group.StartingAt)
+		group.Version++
+		set[groupPath+".rounds"] = group.Rounds
+		set[groupPath+".version"] = group.Version
+		scheduled = append(scheduled, group)
+	}
+	if groupid != "" && len(scheduled) == 0 {
+		return nil, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter, bson.M{"$set": set})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("the groups changed, try again")
+	}
+	return scheduled, nil
+}
+
+// validMatchStatus leaves completing a match to entering its results
+func validMatchStatus(match Match) bool {
+	if len(match.Results) > 0 {
+		return match.Status == MatchCompleted
+	}
+	return match.Status == MatchScheduled || match.Status == MatchLive
+}
+
+// AddMatch adds one match to the end of a group's schedule, its results are
+// entered through SetMatchResults like any other match
+func AddMatch(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, match Match) (Match, error) {
+	if !IsOrganizer(organizer) {
+		return Match{}, errors.New("only organizers can schedule matches")
+	}
+	tournament, r, err := scheduleRound(db, tournamentID, qualifier)
+	if err != nil {
+		return Match{}, err
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return Match{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	group := tournament.Rounds[r].Groups[g]
+	match.MatchID = primitive.NewObjectID().Hex()
+	match.Results = []MatchResult{}
+	if match.Status == "" {
+		match.Status = MatchScheduled
+	}
+	if match.Title == "" {
+		match.Title = "Match " + strconv.Itoa(len(group.Rounds)+1)
+	}
+	if match.MapName == "" {
+		match.MapName = tournament.Rounds[r].MapName
+	}
+	if !validMatchStatus(match) || match.Duration < 0 {
+		return Match{}, errors.New("a new match is scheduled or live and lasts from 0 minutes")
+	}
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{"tournamentid": tournamentID, groupPath + ".groupid": groupid},
+		bson.M{"$push": bson.M{groupPath + ".rounds": match}, "$inc": bson.M{groupPath + ".version": 1}})
+	if err != nil {
+		return Match{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Match{}, errors.New("the groups changed, try again")
+	}
+	return match, nil
+}
+
+// UpdateMatch edits a match's title, start, duration, map and status, its
+// results stay as they are
+func UpdateMatch(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, matchid string, update Match) (Match, error) {
+	if !IsOrganizer(organizer) {
+		return Match{}, errors.New("only organizers can edit matches")
+	}
+	tournament, r, err := scheduleRound(db, tournamentID, qualifier)
+	if err != nil {
+		return Match{}, err
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return Match{}, errors.New("no group " + groupid + " in " + qualifier)
+	}
+	m, found := findGroupMatch(tournament.Rounds[r].Groups[g], matchid)
+	if !found {
+		return Match{}, errors.New("no match " + matchid + " in " + tournament.Rounds[r].Groups[g].Group)
+	}
+	match := tournament.Rounds[r].Groups[g].Rounds[m]
+	if update.Title != "" {
+		match.Title = update.Title
+	}
+	if !update.StartingAt.IsZero() {
+		match.StartingAt = update.StartingAt
+	}
+	if update.Duration != 0 {
+		match.Duration = update.Duration
+	}
+	if update.MapName != "" {
+		match.MapName = update.MapName
+	}
+	if update.Status != "" {
+		match.Status = update.Status
+	}
+	if !validMatchStatus(match) || match.Duration < 0 {
+		return Match{}, errors.New("a match is scheduled or live until its results are entered")
+	}
+
+	// the match has to still be at that index and without results, or still
+	// have results when it had them
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	matchPath := groupPath + ".rounds." + strconv.Itoa(m)
+	filter := bson.M{"tournamentid": tournamentID, matchPath + ".matchid": matchid}
+	if len(match.Results) == 0 {
+		filter[matchPath+".results.0"] = bson.M{"$exists": false}
+	}
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter,
+		bson.M{
+			"$set": bson.M{
+				matchPath + ".title":      match.Title,
+				matchPath + ".startingat": match.StartingAt,
+				matchPath + ".duration":   match.Duration,
+				matchPath + ".mapname":    match.MapName,
+				matchPath + ".status":     match.Status,
+			},
+			"$inc": bson.M{groupPath + ".version": 1},
+		})
+	if err != nil {
+		return Match{}, err
+	}
+	if res.MatchedCount == 0 {
+		return Match{}, errors.New("the match changed, try again")
+	}
+	return match, nil
+}
+
+// DeleteMatch takes a match off a group's schedule, only while it has no
+// results
+func DeleteMatch(db *mongo.Database, organizer User, tournamentID string, qualifier string, groupid string, matchid string) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can delete matches")
+	}
+	tournament, r, err := scheduleRound(db, tournamentID, qualifier)
+	if err != nil {
+		return err
+	}
+	g, found := findGroup(tournament.Rounds[r], groupid)
+	if !found {
+		return errors.New("no group " + groupid + " in " + qualifier)
+	}
+	m, found := findGroupMatch(tournament.Rounds[r].Groups[g], matchid)
+	if !found {
+		return errors.New("no match " + matchid + " in " + tournament.Rounds[r].Groups[g].Group)
+	}
+	groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+	matchPath := groupPath + ".rounds." + strconv.Itoa(m)
+	res, err := db.Collection("Tournaments").UpdateOne(context.TODO(),
+		bson.M{
+			"tournamentid":           tournamentID,
+			matchPath + ".matchid":   matchid,
+			matchPath + ".results.0": bson.M{"$exists": false},
+		},
+		bson.M{
+			"$pull": bson.M{groupPath + ".rounds": bson.M{"matchid": matchid}},
+			"$inc":  bson.M{groupPath + ".version": 1},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("match " + matchid + " has results or changed")
+	}
+	return nil
+}
+
+// GetMatches is the schedule of one group, or of every group in the round
+// when groupid is empty
+func GetMatches(db *mongo.Database, tournamentID string, qualifier string, groupid string) ([]Match, bool) {
+	tournament := GetTournament(db, tournamentID)
+	r, found := findRound(tournament, qualifier)
+	if !found {
+		return nil, false
+	}
+	matches := []Match{}
+	for _, group := range tournament.Rounds[r].Groups {
+		if groupid == "" || group.GroupID == groupid {
+			matches = append(matches, group.Rounds...)
+		}
+	}
+	if groupid != "" {
+		if _, found := findGroup(tournament.Rounds[r], groupid); !found {
+			return nil, false
+		}
+	}
+	return matches, true
+}
+
+// StartScheduledMatches marks the scheduled matches of live tournaments live
+// once their start time passes, RunSchedules calls it
+func StartScheduledMatches(db *mongo.Database) {
+	res, err := db.Collection("Tournaments").Find(context.TODO(), bson.M{
+		"status":                      StatusLive,
+		"rounds.groups.rounds.status": MatchScheduled,
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	now := time.Now()
+	for res.Next(context.TODO()) {
+		var tournament Tournaments
+		res.Decode(&tournament)
+		filter := bson.M{"tournamentid": tournament.TournamentID}
+		set := bson.M{}
+		inc := bson.M{}
+		for r, round := range tournament.Rounds {
+			for g, group := range round.Groups {
+				groupPath := "rounds." + strconv.Itoa(r) + ".groups." + strconv.Itoa(g)
+				for m, match := range group.Rounds {
+					if match.Status != MatchScheduled || match.StartingAt.IsZero() || now.Before(match.StartingAt) {
+						continue
+					}
+					matchPath := groupPath + ".rounds." + strconv.Itoa(m)
+					filter[matchPath+".matchid"] = match.MatchID
+					filter[matchPath+".status"] = MatchScheduled
+					set[matchPath+".status"] = MatchLive
+					inc[groupPath+".version"] = 1
+				}
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		_, err := db.Collection("Tournaments").UpdateOne(context.TODO(), filter, bson.M{"$set": set, "$inc": inc})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// blankTournament is the setup of a tournament without its identity, teams
+// and results. Groups keep their names, times and matches so the schedule
+// carries over, everything played or handed out in them is cleared.
+func blankTournament(tournament Tournaments) Tournaments {
+	tournament.TournamentID = ""
+	tournament.Slug = ""
+	tournament.Status = ""
+	tournament.StreamLinks = nil
+	tournament.Teams = nil
+	tournament.Waitlist = nil
+	rounds := []Rounds{}
+	for _, round := range tournament.Rounds {
+		groups := []Groups{}
+		for _, group := range round.Groups {
+			matches := []Match{}
+			for _, match := range group.Rounds {
+				matches = append(matches, Match{
+					MatchID:    primitive.NewObjectID().Hex(),
+					Title:      match.Title,
+					StartingAt: match.StartingAt,
+					Duration:   match.Duration,
+					MapName:    match.MapName,
+					Status:     MatchScheduled,
+				})
+			}
+			groups = append(groups, Groups{
+				GroupID:    primitive.NewObjectID().Hex(),
+				Group:      group.Group,
+				Teams:      []Team{},
+				Rounds:     matches,
+				Results:    []ResultSubmission{},
+				StartingAt: group.StartingAt,
+				Duration:   group.Duration,
+			})
+		}
+		round.Groups = groups
+		round.QualifiedTeams = nil
+		round.Bracket = nil
+		round.Stage = nil
+		round.IsLocked = false
+		rounds = append(rounds, round)
+	}
+	tournament.Rounds = rounds
+	return tournament
+}
+
+// shiftTime moves a set time, unset ones stay unset
+func shiftTime(at time.Time, by time.Duration) time.Time {
+	if at.IsZero() {
+		return at
+	}
+	return at.Add(by)
+}
+
+// withDates moves a blank tournament to new dates, the dates not given and
+// the round slots, lock times and group schedules keep their distance to the
+// start
+func withDates(tournament Tournaments, dates TournamentDates) (Tournaments, error) {
+	if dates.TournamentStartDate.IsZero() {
+		return tournament, nil
+	}
+	var by time.Duration
+	if !tournament.TournamentStartDate.IsZero() {
+		by = dates.TournamentStartDate.Sub(tournament.TournamentStartDate)
+	} else {
+		for _, round := range tournament.Rounds {
+			if len(round.Slots) > 0 || !round.LockAt.IsZero() {
+				return Tournaments{}, errors.New("the original has no start date to move its round slots from")
+			}
+			for _, group := range round.Groups {
+				if !group.StartingAt.IsZero() {
+					return Tournaments{}, errors.New("the original has no start date to move its groups from")
+				}
+			}
+		}
+	}
+	pick := func(given time.Time, original time.Time) time.Time {
+		if !given.IsZero() {
+			return given.UTC()
+		}
+		return shiftTime(original, by)
+	}
+	tournament.RegistrationStartDate = pick(dates.RegistrationStartDate, tournament.RegistrationStartDate)
+	tournament.RegistrationLastDate = pick(dates.RegistrationLastDate, tournament.RegistrationLastDate)
+	tournament.TournamentStartDate = dates.TournamentStartDate.UTC()
+	tournament.TournamentEndDate = pick(dates.TournamentEndDate, tournament.TournamentEndDate)
+	for r := range tournament.Rounds {
+		slots := []time.Time{}
+		for _, slot := range tournament.Rounds[r].Slots {
+			slots = append(slots, shiftTime(slot, by))
+		}
+		tournament.Rounds[r].Slots = slots
+		tournament.Rounds[r].LockAt = shiftTime(tournament.Rounds[r].LockAt, by)
+		for g := range tournament.Rounds[r].Groups {
+			group := &tournament.Rounds[r].Groups[g]
+			group.StartingAt = shiftTime(group.StartingAt, by)
+			for m := range group.Rounds {
+				group.Rounds[m].StartingAt = shiftTime(group.Rounds[m].StartingAt, by)
+			}
+		}
+	}
+	return tournament, nil
+}
+
+// createFrom adds a tournament made from a template or another tournament
+func createFrom(db *mongo.Database, tournament Tournaments, title string, dates TournamentDates) (Tournaments, error) {
+	if title == "" {
+		return Tournaments{}, errors.New("the new tournament needs a title")
+	}
+	tournament, err := withDates(blankTournament(tournament), dates)
+	if err != nil {
+		return Tournaments{}, err
+	}
+	tournament.Title = title
+	if !AddTournament(db, &tournament) {
+		return Tournaments{}, errors.New("tournament " + title + " could not be created, the title may be taken")
+	}
+	return tournament, nil
+}
+
+// SaveTournamentTemplate stores a template, from an existing tournament when
+// fromTournamentID is given and from template.Tournament otherwise
+func SaveTournamentTemplate(db *mongo.Database, organizer User, template TournamentTemplate, fromTournamentID string) (TournamentTemplate, error) {
+	if !IsOrganizer(organizer) {
+		return TournamentTemplate{}, errors.New("only organizers can save templates")
+	}
+	if fromTournamentID != "" {
+		template.Tournament = GetTournament(db, fromTournamentID)
+		if template.Tournament.TournamentID == "" {
+			return TournamentTemplate{}, errors.New("no tournament " + fromTournamentID)
+		}
+	}
+	if template.Name == "" {
+		return TournamentTemplate{}, errors.New("a template needs a name")
+	}
+	template.Tournament = blankTournament(template.Tournament)
+	if !validPointTable(template.Tournament.PointTable) {
+		return TournamentTemplate{}, errors.New("point table has negative points or an unknown tie breaker")
+	}
+	if !validPrizeSplit(template.Tournament.PrizePool, template.Tournament.PrizeSplit) {
+		return TournamentTemplate{}, errors.New("prize split is invalid")
+	}
+	if !validCheckIn(template.Tournament) {
+		return TournamentTemplate{}, errors.New("check-in settings are invalid")
+	}
+	template.TemplateID = primitive.NewObjectID().Hex()
+	template.GameID = template.Tournament.GameID
+	template.CreatedBy = organizer.User_uuid
+	template.CreatedAt = time.Now().UTC()
+	_, err := db.Collection("TournamentTemplates").InsertOne(context.TODO(), template)
+	if mongo.IsDuplicateKeyError(err) {
+		return TournamentTemplate{}, errors.New("template " + template.Name + " already exists for this game")
+	}
+	if err != nil {
+		return TournamentTemplate{}, err
+	}
+	return template, nil
+}
+
+func GetTournamentTemplate(db *mongo.Database, templateID string) (TournamentTemplate, bool) {
+	var template TournamentTemplate
+	err := db.Collection("TournamentTemplates").FindOne(context.TODO(),
+		bson.M{"templateid": templateID}).Decode(&template)
+	return template, err == nil
+}
+
+// GetTournamentTemplates lists the templates of a game, or all of them when
+// gameid is empty
+func GetTournamentTemplates(db *mongo.Database, gameid string) []TournamentTemplate {
+	filter := bson.M{}
+	if gameid != "" {
+		filter["gameid"] = gameid
+	}
+	res, err := db.Collection("TournamentTemplates").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.M{"name": 1}))
+	templates := []TournamentTemplate{}
+	if err != nil {
+		log.Println(err)
+		return templates
+	}
+	for res.Next(context.TODO()) {
+		var template TournamentTemplate
+		res.Decode(&template)
+		templates = append(templates, template)
+	}
+	return templates
+}
+
+func DeleteTournamentTemplate(db *mongo.Database, organizer User, templateID string) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can delete templates")
+	}
+	res, err := db.Collection("TournamentTemplates").DeleteOne(context.TODO(),
+		bson.M{"templateid": templateID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("no template " + templateID)
+	}
+	return nil
+}
+
+// InstantiateTemplate creates a draft tournament from a template on new dates
+func InstantiateTemplate(db *mongo.Database, organizer User, templateID string, title string, dates TournamentDates) (Tournaments, error) {
+	if !IsOrganizer(organizer) {
+		return Tournaments{}, errors.New("only organizers can create tournaments from templates")
+	}
+	template, found := GetTournamentTemplate(db, templateID)
+	if !found {
+		return Tournaments{}, errors.New("no template " + templateID)
+	}
+	if dates.TournamentStartDate.IsZero() {
+		return Tournaments{}, errors.New("the new tournament needs a start date")
+	}
+	return createFrom(db, template.Tournament, title, dates)
+}
+
+// CloneTournament copies a tournament's setup into a new draft without its
+// teams and results, on the same dates unless new ones are given
+func CloneTournament(db *mongo.Database, organizer User, tournamentID string, title string, dates TournamentDates) (Tournaments, error) {
+	if !IsOrganizer(organizer) {
+		return Tournaments{}, errors.New("only organizers can clone tournaments")
+	}
+	tournament := GetTournament(db, tournamentID)
+	if tournament.TournamentID == "" {
+		return Tournaments{}, errors.New("no tournament " + tournamentID)
+	}
+	return createFrom(db, tournament, title, dates)
+}
+
+// cronSchedule is a parsed five field cron expression
+type cronSchedule struct {
+	minutes  []bool
+	hours    []bool
+	days     []bool
+	months   []bool
+	weekdays []bool
+	anyDay   bool
+	anyWeek  bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly": "0 * * * *",
+	"@daily":  "0 0 * * *",
+	"@weekly": "0 0 * * 0",
+}
+
+// parseCronField reads "*", "5", "1-5", "*/15", "10-40/10" and lists of them
+func parseCronField(field string, min int, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			n, err := strconv.Atoi(part[slash+1:])
+			if err != nil || n < 1 {
+				return nil, errors.New("bad step in " + field)
+			}
+			step = n
+			part = part[:slash]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, errors.New("bad value in " + field)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.New("bad range in " + field)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, errors.New(field + " is out of range")
+		}
+		for v := low; v <= high; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// parseCron reads "minute hour day-of-month month day-of-week"
+func parseCron(expression string) (cronSchedule, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(expression)]; ok {
+		expression = alias
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronSchedule{}, errors.New("a schedule has five fields: minute hour day-of-month month day-of-week")
+	}
+	var schedule cronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return cronSchedule{}, err
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return cronSchedule{}, err
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return cronSchedule{}, err
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return cronSchedule{}, err
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return cronSchedule{}, err
+	}
+	// 7 is another Sunday
+	schedule.weekdays[0] = schedule.weekdays[0] || schedule.weekdays[7]
+	schedule.anyDay = strings.HasPrefix(fields[2], "*")
+	schedule.anyWeek = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+// dayMatches follows cron, when both the day of the month and the weekday
+// are restricted either one will do
+func (schedule cronSchedule) dayMatches(day time.Time) bool {
+	if !schedule.months[int(day.Month())] {
+		return false
+	}
+	byDate := schedule.days[day.Day()]
+	byWeekday := schedule.weekdays[int(day.Weekday())]
+	if !schedule.anyDay && !schedule.anyWeek {
+		return byDate || byWeekday
+	}
+	return byDate && byWeekday
+}
+
+// next is the first time after after that the schedule fires, looking at
+// most five years ahead
+func (schedule cronSchedule) next(after time.Time, location *time.Location) (time.Time, bool) {
+	after = after.In(location)
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, location)
+	for i := 0; i < 5*366; i++ {
+		if schedule.dayMatches(day) {
+			for hour := 0; hour < 24; hour++ {
+				if !schedule.hours[hour] {
+					continue
+				}
+				for minute := 0; minute < 60; minute++ {
+					if !schedule.minutes[minute] {
+						continue
+					}
+					at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, location)
+					if at.After(after) {
+						return at.UTC(), true
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}, false
+}
+
+// defaultScrimRegistrationHours is how far ahead lobbies open when the scrim
+// does not say
+const defaultScrimRegistrationHours = 24
+
+// maxLobbiesPerRun keeps a schedule firing every minute from flooding the
+// lobbies in one run
+const maxLobbiesPerRun = 100
+
+func scrimLocation(scrim Scrim) *time.Location {
+	location, err := time.LoadLocation(scrim.TimeZone)
+	if err != nil || scrim.TimeZone == "" {
+		location, _ = time.LoadLocation(defaultTimeZone)
+	}
+	return location
+}
+
+func validScrim(scrim Scrim) error {
+	if scrim.Title == "" || scrim.GameID == "" {
+		return errors.New("a scrim needs a title and a game")
+	}
+	if scrim.MaxTeams <= 0 || scrim.RegistrationHours < 0 {
+		return errors.New("a scrim needs room for teams and no negative registration hours")
+	}
+	if _, err := time.LoadLocation(scrim.TimeZone); err != nil {
+		return errors.New("unknown time zone " + scrim.TimeZone)
+	}
+	if _, err := parseCron(scrim.Schedule); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddScrim starts a recurring scrim, its lobbies are generated by
+// GenerateScrimLobbies
+func AddScrim(db *mongo.Database, organizer User, scrim Scrim) (Scrim, error) {
+	if !IsOrganizer(organizer) {
+		return Scrim{}, errors.New("only organizers can host scrims")
+	}
+	if scrim.TimeZone == "" {
+		scrim.TimeZone = defaultTimeZone
+	}
+	if err := validScrim(scrim); err != nil {
+		return Scrim{}, err
+	}
+	scrim.ScrimID = primitive.NewObjectID().Hex()
+	scrim.Active = true
+	scrim.Organizer = organizer.User_uuid
+	scrim.CreatedAt = time.Now().UTC()
+	scrim.LastLobbyAt = time.Time{}
+	_, err := db.Collection("Scrims").InsertOne(context.TODO(), scrim)
+	if err != nil {
+		return Scrim{}, err
+	}
+	return scrim, nil
+}
+
+// UpdateScrim changes a scrim's settings, lobbies already generated keep
+// theirs. Pausing and resuming goes through SetScrimActive.
+func UpdateScrim(db *mongo.Database, organizer User, scrimID string, update Scrim) (Scrim, error) {
+	if !IsOrganizer(organizer) {
+		return Scrim{}, errors.New("only organizers can edit scrims")
+	}
+	if update.TimeZone == "" {
+		update.TimeZone = defaultTimeZone
+	}
+	if err := validScrim(update); err != nil {
+		return Scrim{}, err
+	}
+	var scrim Scrim
+	err := db.Collection("Scrims").FindOneAndUpdate(context.TODO(),
+		bson.M{"scrimid": scrimID},
+		bson.M{"$set": bson.M{
+			"title":             update.Title,
+			"gameid":            update.GameID,
+			"teamtype":          update.TeamType,
+			"mapname":           update.MapName,
+			"schedule":          update.Schedule,
+			"timezone":          update.TimeZone,
+			"maxteams":          update.MaxTeams,
+			"registrationhours": update.RegistrationHours,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&scrim)
+	if err != nil {
+		return Scrim{}, errors.New("no scrim " + scrimID)
+	}
+	return scrim, nil
+}
+
+// SetScrimActive pauses or resumes a scrim, a paused scrim generates no
+// lobbies
+func SetScrimActive(db *mongo.Database, organizer User, scrimID string, active bool) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can pause or resume scrims")
+	}
+	res, err := db.Collection("Scrims").UpdateOne(context.TODO(),
+		bson.M{"scrimid": scrimID}, bson.M{"$set": bson.M{"active": active}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("no scrim " + scrimID)
+	}
+	return nil
+}
+
+// GetScrims lists the scrims of a game, or all of them when gameid is empty
+func GetScrims(db *mongo.Database, gameid string) []Scrim {
+	filter := bson.M{}
+	if gameid != "" {
+		filter["gameid"] = gameid
+	}
+	res, err := db.Collection("Scrims").Find(context.TODO(), filter)
+	scrims := []Scrim{}
+	if err != nil {
+		log.Println(err)
+		return scrims
+	}
+	for res.Next(context.TODO()) {
+		var scrim Scrim
+		res.Decode(&scrim)
+		scrims = append(scrims, scrim)
+	}
+	return scrims
+}
+
+// GetScrimLobbies lists a scrim's lobbies that have not started yet, soonest
+// first
+func GetScrimLobbies(db *mongo.Database, scrimID string) []ScrimLobby {
+	res, err := db.Collection("ScrimLobbies").Find(context.TODO(),
+		bson.M{"scrimid": scrimID, "startingat": bson.M{"$gt": time.Now().UTC()}},
+		options.Find().SetSort(bson.M{"startingat": 1}))
+	lobbies := []ScrimLobby{}
+	if err != nil {
+		log.Println(err)
+		return lobbies
+	}
+	for res.Next(context.TODO()) {
+		var lobby ScrimLobby
+		res.Decode(&lobby)
+		lobbies = append(lobbies, lobby)
+	}
+	return lobbies
+}
+
+// GenerateScrimLobbies opens the lobbies of every active scrim that start
+// within its registration hours, RunSchedules calls it
+func GenerateScrimLobbies(db *mongo.Database) {
+	res, err := db.Collection("Scrims").Find(context.TODO(), bson.M{"active": true})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	now := time.Now().UTC()
+	for res.Next(context.TODO()) {
+		var scrim Scrim
+		res.Decode(&scrim)
+		schedule, err := parseCron(scrim.Schedule)
+		if err != nil {
+			log.Println("> Scrim " + scrim.ScrimID + ": " + err.Error())
+			continue
+		}
+		hours := scrim.RegistrationHours
+		if hours <= 0 {
+			hours = defaultScrimRegistrationHours
+		}
+		until := now.Add(time.Duration(hours) * time.Hour)
+		// lobbies missed while the scrim was paused are not made up
+		from := scrim.LastLobbyAt
+		if from.Before(now) {
+			from = now
+		}
+		location := scrimLocation(scrim)
+		generated := 0
+		for generated < maxLobbiesPerRun {
+			startingAt, ok := schedule.next(from, location)
+			if !ok || startingAt.After(until) {
+				break
+			}
+			_, err := db.Collection("ScrimLobbies").InsertOne(context.TODO(), ScrimLobby{
+				LobbyID:    primitive.NewObjectID().Hex(),
+				ScrimID:    scrim.ScrimID,
+				Title:      scrim.Title + " " + startingAt.In(location).Format("2 Jan 15:04"),
+				GameID:     scrim.GameID,
+				TeamType:   scrim.TeamType,
+				MapName:    scrim.MapName,
+				StartingAt: startingAt,
+				MaxTeams:   scrim.MaxTeams,
+				Teams:      []Team{},
+			})
+			if err != nil && !mongo.IsDuplicateKeyError(err) {
+				log.Println(err)
+				break
+			}
+			from = startingAt
+			generated++
+		}
+		if generated > 0 {
+			_, err := db.Collection("Scrims").UpdateOne(context.TODO(),
+				bson.M{"scrimid": scrim.ScrimID},
+				bson.M{"$max": bson.M{"lastlobbyat": from}})
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// lobbyHasCapacity matches lobbies with room for another team
+var lobbyHasCapacity = bson.M{"$expr": bson.M{"$lt": []interface{}{
+	bson.M{"$size": bson.M{"$ifNull": []interface{}{"$teams", []interface{}{}}}},
+	"$maxteams",
+}}}
+
+// JoinScrimLobby enters the captain's team into a lobby that has not started,
+// first come first served
+func JoinScrimLobby(db *mongo.Database, requester User, lobbyID string, teamid string) (ScrimLobby, error) {
+	if !CanEditTeam(db, requester, teamid) {
+		return ScrimLobby{}, errors.New("only the captain can enter the team")
+	}
+	team, found := GetTeamByID(db, teamid)
+	if !found {
+		return ScrimLobby{}, errors.New("no team " + teamid)
+	}
+	filter := bson.M{
+		"lobbyid":      lobbyID,
+		"gameid":       team.GameID,
+		"startingat":   bson.M{"$gt": time.Now().UTC()},
+		"teams.teamid": bson.M{"$ne": teamid},
+		"$or":          []bson.M{{"teamtype": ""}, {"teamtype": team.TeamType}},
+	}
+	for key, value := range lobbyHasCapacity {
+		filter[key] = value
+	}
+	var lobby ScrimLobby
+	err := db.Collection("ScrimLobbies").FindOneAndUpdate(context.TODO(), filter,
+		bson.M{"$push": bson.M{"teams": team}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&lobby)
+	if err != nil {
+		return ScrimLobby{}, errors.New("the lobby is full, has started, is for another game or team type, or the team is already in")
+	}
+	if lobby.RoomSent {
+		notifyTeam(db, team, "The room for "+lobby.Title+" is ready")
+	}
+	return lobby, nil
+}
+
+// LeaveScrimLobby takes the captain's team out of a lobby before it starts
+func LeaveScrimLobby(db *mongo.Database, requester User, lobbyID string, teamid string) error {
+	if !CanEditTeam(db, requester, teamid) {
+		return errors.New("only the captain can take the team out")
+	}
+	res, err := db.Collection("ScrimLobbies").UpdateOne(context.TODO(),
+		bson.M{"lobbyid": lobbyID, "teams.teamid": teamid, "startingat": bson.M{"$gt": time.Now().UTC()}},
+		bson.M{"$pull": bson.M{"teams": bson.M{"teamid": teamid}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("the team is not in a lobby that is still to start")
+	}
+	return nil
+}
+
+// SetScrimRoom sets or rotates a lobby's room, the teams hear about it from
+// SendScrimRooms
+func SetScrimRoom(db *mongo.Database, organizer User, lobbyID string, roomID string, password string) error {
+	if !IsOrganizer(organizer) {
+		return errors.New("only organizers can set scrim rooms")
+	}
+	if roomID == "" {
+		return errors.New("a room needs an id")
+	}
+	res, err := db.Collection("ScrimLobbies").UpdateOne(context.TODO(),
+		bson.M{"lobbyid": lobbyID},
+		bson.M{
+			"$set": bson.M{"roomid": roomID, "password": password, "roomsent": false},
+			"$inc": bson.M{"roomversion": 1},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("no lobby " + lobbyID)
+	}
+	return nil
+}
+
+// SendScrimRooms tells the teams of every lobby starting within the room
+// reveal time that its room is ready, RunSchedules calls it
+func SendScrimRooms(db *mongo.Database) {
+	res, err := db.Collection("ScrimLobbies").Find(context.TODO(), bson.M{
+		"roomid":     bson.M{"$nin": []interface{}{nil, ""}},
+		"roomsent":   bson.M{"$ne": true},
+		"startingat": bson.M{"$lte": time.Now().UTC().Add(defaultRoomRevealMinutes * time.Minute)},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for res.Next(context.TODO()) {
+		var lobby ScrimLobby
+		res.Decode(&lobby)
+		// claiming the version read keeps a rotation in between from being
+		// marked as sent
+		claimed, err := db.Collection("ScrimLobbies").UpdateOne(context.TODO(),
+			bson.M{"lobbyid": lobby.LobbyID, "roomversion": lobby.RoomVersion, "roomsent": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"roomsent": true}})
+		if err != nil || claimed.ModifiedCount == 0 {
+			continue
+		}
+		for _, team := range lobby.Teams {
+			notifyTeam(db, team, "The room for "+lobby.Title+" is ready")
+		}
+	}
+}
+
+// GetScrimRoom hands a lobby's room to the players of its teams from the
+// room reveal time before it starts, organizers can always read it
+func GetScrimRoom(db *mongo.Database, requester User, lobbyID string) (RoomCredentials, error) {
+	var lobby ScrimLobby
+	err := db.Collection("ScrimLobbies").FindOne(context.TODO(),
+		bson.M{"lobbyid": lobbyID}).Decode(&lobby)
+	if err != nil {
+		return RoomCredentials{}, errors.New("no lobby " + lobbyID)
+	}
+	if !IsOrganizer(requester) {
+		if _, found := teamOfMember(lobby.Teams, requester.User_uuid); !found {
+			return RoomCredentials{}, errors.New("only players in the lobby can see its room")
+		}
+		if time.Now().Before(lobby.StartingAt.Add(-defaultRoomRevealMinutes * time.Minute)) {
+			return RoomCredentials{}, errors.New("the room is shown " + strconv.Itoa(defaultRoomRevealMinutes) + " minutes before the lobby starts")
+		}
+	}
+	if lobby.RoomID == "" {
+		return RoomCredentials{}, errors.New("the room is not set yet")
+	}
+	return RoomCredentials{
+		GroupID:    lobby.LobbyID,
+		Group:      lobby.Title,
+		RoomID:     lobby.RoomID,
+		Password:   lobby.Password,
+		Version:    lobby.RoomVersion,
+		StartingAt: lobby.StartingAt,
+	}, nil
 }
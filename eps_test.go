@@ -0,0 +1,690 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to MONGO_URI and hands out a throwaway database,
+// tests that need one are skipped without it
+func testDatabase(t *testing.T) *mongo.Database {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI is not set")
+	}
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("haexr_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.TODO())
+		client.Disconnect(context.TODO())
+	})
+	return db
+}
+
+// slotTournament inserts a tournament with teams registered teams and one
+// battle royale round of groups of perGroup teams over the given slots
+func slotTournament(t *testing.T, db *mongo.Database, teams int, perGroup int, slots []time.Time) Tournaments {
+	tournament := Tournaments{
+		TournamentID: primitive.NewObjectID().Hex(),
+		Title:        "Allocator " + primitive.NewObjectID().Hex(),
+		GameID:       "bgmi",
+		TotalTeams:   teams,
+		Status:       StatusRegistrationClosed,
+		Rounds: []Rounds{{
+			QualifierName:         "Qualifier",
+			Slots:                 slots,
+			Groups:                []Groups{},
+			NumberOfTeamsPerGroup: perGroup,
+		}},
+	}
+	for i := 0; i < teams; i++ {
+		tournament.Teams = append(tournament.Teams, Team{
+			TeamID:   "team-" + strconv.Itoa(i),
+			TeamName: "Team " + strconv.Itoa(i),
+			GameID:   "bgmi",
+		})
+	}
+	if _, err := db.Collection("Tournaments").InsertOne(context.TODO(), tournament); err != nil {
+		t.Fatal(err)
+	}
+	return tournament
+}
+
+// joinGroup retries while concurrent joins keep the slot busy
+func joinGroup(db *mongo.Database, tournamentID string, slot time.Time, teamid string) (Groups, error) {
+	var group Groups
+	var err error
+	for attempt := 0; attempt < 100; attempt++ {
+		group, err = AddTeamInTournamentGroup(db, tournamentID, "Qualifier", Groups{StartingAt: slot}, teamid)
+		if err == nil || !strings.Contains(err.Error(), "busy") {
+			break
+		}
+	}
+	return group, err
+}
+
+func TestAddTeamInTournamentGroupConcurrentJoins(t *testing.T) {
+	db := testDatabase(t)
+	slots := []time.Time{
+		time.Date(2022, 2, 26, 7, 0, 0, 0, time.UTC),
+		time.Date(2022, 2, 26, 8, 0, 0, 0, time.UTC),
+	}
+	const teams, perGroup = 48, 4
+	tournament := slotTournament(t, db, teams, perGroup, slots)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, teams)
+	for i := 0; i < teams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := joinGroup(db, tournament.TournamentID, slots[i%len(slots)], "team-"+strconv.Itoa(i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stored := GetTournament(db, tournament.TournamentID)
+	placed := map[string]string{}
+	for _, group := range stored.Rounds[0].Groups {
+		if len(group.Teams) > perGroup {
+			t.Errorf("%s has %d teams, the limit is %d", group.Group, len(group.Teams), perGroup)
+		}
+		for _, team := range group.Teams {
+			if other, twice := placed[team.TeamID]; twice {
+				t.Errorf("%s is in %s and %s", team.TeamID, other, group.Group)
+			}
+			placed[team.TeamID] = group.Group
+			if want := slots[teamIndex(t, team.TeamID)%len(slots)]; !group.StartingAt.Equal(want) {
+				t.Errorf("%s landed at %v instead of %v", team.TeamID, group.StartingAt, want)
+			}
+		}
+	}
+	if len(placed) != teams {
+		t.Errorf("%d of %d teams were placed", len(placed), teams)
+	}
+	if len(stored.Rounds[0].Groups) != teams/perGroup {
+		t.Errorf("%d groups were opened, %d are needed", len(stored.Rounds[0].Groups), teams/perGroup)
+	}
+}
+
+func TestAddTeamInTournamentGroupSameTeamTwice(t *testing.T) {
+	db := testDatabase(t)
+	slot := time.Date(2022, 2, 26, 7, 0, 0, 0, time.UTC)
+	tournament := slotTournament(t, db, 8, 4, []time.Time{slot})
+
+	const attempts = 16
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	joined := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := joinGroup(db, tournament.TournamentID, slot, "team-0"); err == nil {
+				mu.Lock()
+				joined++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if joined != 1 {
+		t.Errorf("team-0 joined %d times", joined)
+	}
+
+	count, err := db.Collection("Tournaments").CountDocuments(context.TODO(), bson.M{
+		"tournamentid":                 tournament.TournamentID,
+		"rounds.0.groups.teams.teamid": "team-0",
+	})
+	if err != nil || count != 1 {
+		t.Errorf("team-0 is not in exactly one group: %v %v", count, err)
+	}
+	stored := GetTournament(db, tournament.TournamentID)
+	found := 0
+	for _, group := range stored.Rounds[0].Groups {
+		for _, team := range group.Teams {
+			if team.TeamID == "team-0" {
+				found++
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("team-0 is placed %d times", found)
+	}
+}
+
+func teamIndex(t *testing.T, teamid string) int {
+	i, err := strconv.Atoi(strings.TrimPrefix(teamid, "team-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{1, []int{1}},
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+	for _, test := range tests {
+		got := seedOrder(test.size)
+		if !equalInts(got, test.want) {
+			t.Errorf("seedOrder(%d) = %v, want %v", test.size, got, test.want)
+		}
+	}
+}
+
+func TestBuildBracket(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		seeds   []string
+		matches int
+		status  map[string]string // MatchID to status right after building
+		winner  map[string]string // MatchID to the team a bye moved on
+	}{
+		{
+			name:    "single elimination with byes",
+			format:  FormatSingleElimination,
+			seeds:   []string{"t1", "t2", "t3", "t4", "t5"},
+			matches: 7,
+			status: map[string]string{
+				"W1-1": MatchBye, "W1-2": MatchReady, "W1-3": MatchBye, "W1-4": MatchBye,
+				"W2-1": MatchPending, "W2-2": MatchReady, "W3-1": MatchPending,
+			},
+			winner: map[string]string{"W1-1": "t1", "W1-3": "t2", "W1-4": "t3"},
+		},
+		{
+			name:    "double elimination",
+			format:  FormatDoubleElimination,
+			seeds:   []string{"t1", "t2", "t3", "t4"},
+			matches: 7,
+			status: map[string]string{
+				"W1-1": MatchReady, "W1-2": MatchReady, "W2-1": MatchPending,
+				"L1-1": MatchPending, "L2-1": MatchPending, "GF1": MatchPending, "GF2": MatchPending,
+			},
+		},
+		{
+			name:    "double elimination with a bye in the losers bracket",
+			format:  FormatDoubleElimination,
+			seeds:   []string{"t1", "t2", "t3"},
+			matches: 7,
+			status: map[string]string{
+				"W1-1": MatchBye, "W1-2": MatchReady, "W2-1": MatchPending,
+				"L1-1": MatchPending, "GF1": MatchPending,
+			},
+			winner: map[string]string{"W1-1": "t1"},
+		},
+	}
+	for _, test := range tests {
+		bracket, err := BuildBracket(test.format, test.seeds)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(bracket.Matches) != test.matches {
+			t.Errorf("%s: %d matches, want %d", test.name, len(bracket.Matches), test.matches)
+		}
+		for id, status := range test.status {
+			if match := findMatch(&bracket, id); match == nil || match.Status != status {
+				t.Errorf("%s: %s is %+v, want %s", test.name, id, match, status)
+			}
+		}
+		for id, winner := range test.winner {
+			if match := findMatch(&bracket, id); match == nil || match.Winner != winner {
+				t.Errorf("%s: %s went to %+v, want %s", test.name, id, match, winner)
+			}
+		}
+	}
+
+	if _, err := BuildBracket(FormatSingleElimination, []string{"t1"}); err == nil {
+		t.Error("a bracket of one team was built")
+	}
+	if _, err := BuildBracket(FormatSwiss, []string{"t1", "t2"}); err == nil {
+		t.Error("a swiss bracket was built")
+	}
+}
+
+func TestBracketSeeds(t *testing.T) {
+	for teams := 2; teams <= 9; teams++ {
+		seeds := []string{}
+		for i := 0; i < teams; i++ {
+			seeds = append(seeds, "t"+strconv.Itoa(i))
+		}
+		for _, format := range []string{FormatSingleElimination, FormatDoubleElimination} {
+			bracket, err := BuildBracket(format, seeds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bracketSeeds(bracket); !equalStrings(got, seeds) {
+				t.Errorf("%s of %d teams: seeds read back as %v", format, teams, got)
+			}
+		}
+	}
+}
+
+func TestReplaceSeed(t *testing.T) {
+	seeds := []string{"a", "b", "c"}
+	tests := []struct {
+		teamid      string
+		replacement string
+		want        []string
+	}{
+		{"b", "d", []string{"a", "d", "c"}},
+		{"b", "", []string{"a", "c"}},
+		{"b", "c", []string{"a", "c"}},
+		{"e", "d", []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		if got := replaceSeed(seeds, test.teamid, test.replacement); !equalStrings(got, test.want) {
+			t.Errorf("replacing %s with %q: %v, want %v", test.teamid, test.replacement, got, test.want)
+		}
+	}
+}
+
+// playBracket reports match id as won by winner the way ReportBracketMatch does
+func playBracket(t *testing.T, bracket *Bracket, id string, winner string) {
+	match := findMatch(bracket, id)
+	if match == nil || match.Status != MatchReady {
+		t.Fatalf("%s is not ready: %+v", id, match)
+	}
+	if winner == match.TeamA {
+		match.ScoreA, match.ScoreB = 1, 0
+		finishMatch(bracket, match, match.TeamA, match.TeamB, MatchCompleted)
+	} else {
+		match.ScoreA, match.ScoreB = 0, 1
+		finishMatch(bracket, match, match.TeamB, match.TeamA, MatchCompleted)
+	}
+	settleBracket(bracket)
+}
+
+func TestDoubleEliminationGrandFinal(t *testing.T) {
+	tests := []struct {
+		name     string
+		final    []string // GF1 winner, then GF2 winner if there is a reset
+		champion string
+		reset    string // GF2 status
+		ranking  []string
+	}{
+		{"winners bracket champion wins", []string{"t1"}, "t1", MatchVoid, []string{"t1", "t2", "t3", "t4"}},
+		{"losers bracket champion forces a reset", []string{"t2", "t2"}, "t2", MatchCompleted, []string{"t2", "t1", "t3", "t4"}},
+		{"reset won by the winners bracket champion", []string{"t2", "t1"}, "t1", MatchCompleted, []string{"t1", "t2", "t3", "t4"}},
+	}
+	for _, test := range tests {
+		bracket, err := BuildBracket(FormatDoubleElimination, []string{"t1", "t2", "t3", "t4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		playBracket(t, &bracket, "W1-1", "t1")
+		playBracket(t, &bracket, "W1-2", "t2")
+		playBracket(t, &bracket, "W2-1", "t1")
+		playBracket(t, &bracket, "L1-1", "t3")
+		playBracket(t, &bracket, "L2-1", "t2")
+		if gf := findMatch(&bracket, "GF1"); gf.TeamA != "t1" || gf.TeamB != "t2" {
+			t.Fatalf("%s: the grand final is %s against %s", test.name, gf.TeamA, gf.TeamB)
+		}
+		playBracket(t, &bracket, "GF1", test.final[0])
+		if len(test.final) > 1 {
+			playBracket(t, &bracket, "GF2", test.final[1])
+		}
+		if bracket.Champion != test.champion {
+			t.Errorf("%s: champion %q, want %q", test.name, bracket.Champion, test.champion)
+		}
+		if gf := findMatch(&bracket, "GF2"); gf.Status != test.reset {
+			t.Errorf("%s: the reset is %s, want %s", test.name, gf.Status, test.reset)
+		}
+		if got := bracketRanking(bracket); !equalStrings(got, test.ranking) {
+			t.Errorf("%s: ranked %v, want %v", test.name, got, test.ranking)
+		}
+	}
+}
+
+func TestRoundRobinSchedule(t *testing.T) {
+	for teams := 2; teams <= 9; teams++ {
+		pool := []string{}
+		for i := 0; i < teams; i++ {
+			pool = append(pool, "t"+strconv.Itoa(i))
+		}
+		schedule := roundRobinSchedule(pool)
+		wantRounds := teams - 1
+		if teams%2 == 1 {
+			wantRounds = teams
+		}
+		if len(schedule) != wantRounds {
+			t.Errorf("%d teams: %d rounds, want %d", teams, len(schedule), wantRounds)
+		}
+		met := map[string]int{}
+		for r, pairs := range schedule {
+			busy := map[string]bool{}
+			for _, pair := range pairs {
+				for _, team := range pair {
+					if team != "" && busy[team] {
+						t.Errorf("%d teams: %s plays twice in round %d", teams, team, r+1)
+					}
+					busy[team] = true
+				}
+				if pair[0] == "" || pair[1] == "" {
+					continue
+				}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				met[pair[0]+"|"+pair[1]]++
+			}
+		}
+		if len(met) != teams*(teams-1)/2 {
+			t.Errorf("%d teams: %d pairings, want %d", teams, len(met), teams*(teams-1)/2)
+		}
+		for pair, times := range met {
+			if times != 1 {
+				t.Errorf("%d teams: %s meet %d times", teams, pair, times)
+			}
+		}
+	}
+}
+
+func TestPairSwiss(t *testing.T) {
+	tests := []struct {
+		name   string
+		order  []string
+		points map[string]int
+		played []string
+		want   [][2]string
+		ok     bool
+	}{
+		{
+			name:  "top half against bottom half",
+			order: []string{"a", "b", "c", "d"},
+			want:  [][2]string{{"a", "c"}, {"b", "d"}},
+			ok:    true,
+		},
+		{
+			name:   "no rematch",
+			order:  []string{"a", "b", "c", "d"},
+			played: []string{"a|c"},
+			want:   [][2]string{{"a", "d"}, {"b", "c"}},
+			ok:     true,
+		},
+		{
+			name:   "a team floats down a score group",
+			order:  []string{"a", "b", "c", "d"},
+			points: map[string]int{"a": 3, "b": 3},
+			played: []string{"a|b"},
+			want:   [][2]string{{"a", "c"}, {"b", "d"}},
+			ok:     true,
+		},
+		{
+			name:   "everyone has met",
+			order:  []string{"a", "b"},
+			played: []string{"a|b"},
+			ok:     false,
+		},
+	}
+	for _, test := range tests {
+		played := map[string]bool{}
+		for _, pair := range test.played {
+			teams := strings.Split(pair, "|")
+			played[teams[0]+"|"+teams[1]] = true
+			played[teams[1]+"|"+teams[0]] = true
+		}
+		points := test.points
+		if points == nil {
+			points = map[string]int{}
+		}
+		got, ok := pairSwiss(test.order, points, played)
+		if ok != test.ok {
+			t.Errorf("%s: ok = %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if ok && !equalPairs(got, test.want) {
+			t.Errorf("%s: paired %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSwissStageHasNoRematches(t *testing.T) {
+	for teams := 2; teams <= 16; teams++ {
+		seeds := []string{}
+		for i := 0; i < teams; i++ {
+			seeds = append(seeds, "t"+strconv.Itoa(i))
+		}
+		if _, err := BuildStage(FormatSwiss, seeds, 0, teams/2+1, nil); err == nil {
+			t.Errorf("%d teams: %d swiss rounds were allowed", teams, teams/2+1)
+		}
+		stage, err := BuildStage(FormatSwiss, seeds, 0, teams/2, nil)
+		if err != nil {
+			t.Errorf("%d teams: %v", teams, err)
+			continue
+		}
+		for {
+			for i := range stage.Matches {
+				match := &stage.Matches[i]
+				if match.Status != MatchReady {
+					continue
+				}
+				// the better seed wins, which keeps the score groups uneven
+				match.Status = MatchCompleted
+				match.Winner, match.Loser = match.TeamA, match.TeamB
+				if seedOf(stage, match.TeamB) < seedOf(stage, match.TeamA) {
+					match.Winner, match.Loser = match.TeamB, match.TeamA
+				}
+			}
+			if stage.CurrentRound >= stage.Rounds {
+				break
+			}
+			pairSwissRound(&stage, nil)
+		}
+		met := map[string]bool{}
+		for _, match := range stage.Matches {
+			if match.Status == MatchBye {
+				continue
+			}
+			if met[match.TeamA+"|"+match.TeamB] {
+				t.Errorf("%d teams: %s and %s met twice", teams, match.TeamA, match.TeamB)
+			}
+			met[match.TeamA+"|"+match.TeamB] = true
+			met[match.TeamB+"|"+match.TeamA] = true
+		}
+	}
+}
+
+func seedOf(stage Stage, teamid string) int {
+	for i, seed := range stage.Seeds {
+		if seed == teamid {
+			return i
+		}
+	}
+	return len(stage.Seeds)
+}
+
+func TestStageTable(t *testing.T) {
+	played := func(id string, a string, b string, scoreA int, scoreB int) HeadToHeadMatch {
+		match := HeadToHeadMatch{MatchID: id, TeamA: a, TeamB: b, ScoreA: scoreA, ScoreB: scoreB, Status: MatchCompleted}
+		if scoreA > scoreB {
+			match.Winner, match.Loser = a, b
+		} else if scoreB > scoreA {
+			match.Winner, match.Loser = b, a
+		}
+		return match
+	}
+	matches := []HeadToHeadMatch{
+		played("S1-1", "a", "b", 2, 1),
+		played("S1-2", "c", "d", 1, 1),
+		played("S2-1", "a", "c", 3, 0),
+		played("S2-2", "b", "d", 2, 0),
+	}
+	tests := []struct {
+		name  string
+		stage Stage
+		want  []StageStanding
+	}{
+		{
+			// c and d are level on points, c met the stronger opponents
+			name: "swiss ranks on buchholz before score difference",
+			stage: Stage{Format: FormatSwiss, Matches: matches, Table: []StageStanding{
+				{TeamID: "d"}, {TeamID: "c"}, {TeamID: "b"}, {TeamID: "a"},
+			}},
+			want: []StageStanding{
+				{TeamID: "a", Played: 2, Wins: 2, Points: 6, Buchholz: 4, ScoreDiff: 4, Rank: 1},
+				{TeamID: "b", Played: 2, Wins: 1, Losses: 1, Points: 3, Buchholz: 7, ScoreDiff: 1, Rank: 2},
+				{TeamID: "c", Played: 2, Draws: 1, Losses: 1, Points: 1, Buchholz: 7, ScoreDiff: -3, Rank: 3},
+				{TeamID: "d", Played: 2, Draws: 1, Losses: 1, Points: 1, Buchholz: 4, ScoreDiff: -2, Rank: 4},
+			},
+		},
+		{
+			name: "round robin ranks within each pool",
+			stage: Stage{Format: FormatRoundRobin, Matches: matches, Table: []StageStanding{
+				{TeamID: "d", Group: "Group A"}, {TeamID: "a", Group: "Group A"},
+				{TeamID: "c", Group: "Group B"}, {TeamID: "b", Group: "Group B"},
+			}},
+			want: []StageStanding{
+				{TeamID: "a", Group: "Group A", Played: 2, Wins: 2, Points: 6, ScoreDiff: 4, Rank: 1},
+				{TeamID: "d", Group: "Group A", Played: 2, Draws: 1, Losses: 1, Points: 1, ScoreDiff: -2, Rank: 2},
+				{TeamID: "b", Group: "Group B", Played: 2, Wins: 1, Losses: 1, Points: 3, ScoreDiff: 1, Rank: 1},
+				{TeamID: "c", Group: "Group B", Played: 2, Draws: 1, Losses: 1, Points: 1, ScoreDiff: -3, Rank: 2},
+			},
+		},
+		{
+			name: "a bye is a win",
+			stage: Stage{Format: FormatSwiss, Table: []StageStanding{{TeamID: "a"}, {TeamID: "b"}}, Matches: []HeadToHeadMatch{
+				{MatchID: "S1-1", TeamA: "b", Winner: "b", Status: MatchBye},
+			}},
+			want: []StageStanding{
+				{TeamID: "b", Played: 1, Wins: 1, Points: 3, Rank: 1},
+				{TeamID: "a", Rank: 2},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := stageTable(test.stage)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: %d lines, want %d", test.name, len(got), len(test.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: line %d is %+v, want %+v", test.name, i+1, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPairs(a [][2]string, b [][2]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@yearly",
+	} {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("%q was accepted", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// a Tuesday
+	after := time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)
+	india := time.FixedZone("IST", 5*60*60+30*60)
+	tests := []struct {
+		expression string
+		location   *time.Location
+		want       time.Time
+		ok         bool
+	}{
+		{"*/15 * * * *", time.UTC, time.Date(2022, 3, 1, 10, 45, 0, 0, time.UTC), true},
+		{"30 10 * * *", time.UTC, time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC), true},
+		{"10-40/10 10 * * *", time.UTC, time.Date(2022, 3, 1, 10, 40, 0, 0, time.UTC), true},
+		{"0,45 * * * *", time.UTC, time.Date(2022, 3, 1, 10, 45, 0, 0, time.UTC), true},
+		{"@hourly", time.UTC, time.Date(2022, 3, 1, 11, 0, 0, 0, time.UTC), true},
+		{"@daily", time.UTC, time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), true},
+		{"@weekly", time.UTC, time.Date(2022, 3, 6, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 * * 7", time.UTC, time.Date(2022, 3, 6, 0, 0, 0, 0, time.UTC), true},
+		{"0 9 * * 1-5", time.UTC, time.Date(2022, 3, 2, 9, 0, 0, 0, time.UTC), true},
+		// the 13th or a Friday, whichever comes first
+		{"0 12 13 * 5", time.UTC, time.Date(2022, 3, 4, 12, 0, 0, 0, time.UTC), true},
+		{"0 0 29 2 *", time.UTC, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), true},
+		{"0 9 * * *", india, time.Date(2022, 3, 2, 3, 30, 0, 0, time.UTC), true},
+		{"0 0 30 2 *", time.UTC, time.Time{}, false},
+	}
+	for _, test := range tests {
+		schedule, err := parseCron(test.expression)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		got, ok := schedule.next(after, test.location)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("%q in %s: next is %v %v, want %v %v", test.expression, test.location, got, ok, test.want, test.ok)
+		}
+	}
+}
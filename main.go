@@ -3,10 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/qinains/fastergoding"
@@ -63,6 +72,15 @@ func main() {
 
 	if ServerOK {
 		fmt.Println("Successfully connected and pinged.")
+		moveLegacyUploads()
+		MigrateLegacyUsers(client.Database(currentDB))
+		MigrateLegacyTournaments(client.Database(currentDB))
+		EnsureIndexes(client.Database(currentDB))
+		go func() {
+			for range time.Tick(time.Minute) {
+				RunSchedules(client.Database(currentDB))
+			}
+		}()
 	}
 
 	// Root API
@@ -181,16 +199,128 @@ func main() {
 		return c.SendStatus(NotAcceptable)
 	})
 
+	// Substitutions once a roster is locked, reviewed by an admin
+	server.Post("/requestsubstitution", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester    Credentials
+			Substitution Substitution
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && RequestSubstitution(client.Database(currentDB), requester, body.Substitution) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	server.Post("/reviewsubstitution", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester      Credentials
+			SubstitutionID string
+			Approve        bool
+			Note           string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		reviewer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && ReviewSubstitution(client.Database(currentDB), reviewer, body.SubstitutionID, body.Approve, body.Note) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	server.Get("/getsubstitutions", func(c *fiber.Ctx) error {
+		return c.JSON(GetSubstitutions(client.Database(currentDB), c.Query("teamid")))
+	})
+
 	// Add Users GameInformation
 	server.Post("/addgameinformationofuser", func(c *fiber.Ctx) error {
-		gameInformationOfUser := &GameInformationOfUser{}
-		json.Unmarshal(c.Body(), gameInformationOfUser)
-		if AddUsersGameInfo(client.Database(currentDB), gameInformationOfUser) {
+		type Body struct {
+			Requester Credentials
+			Profile   GameInformationOfUser
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && AddUsersGameInfo(client.Database(currentDB), requester, &body.Profile) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	server.Get("/getgameinformationofuser", func(c *fiber.Ctx) error {
+		return c.JSON(GetUsersGameInfo(client.Database(currentDB), c.Query("user")))
+	})
+
+	// Looking for team / looking for players board
+	server.Post("/addrecruitmentpost", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Post      RecruitmentPost
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && AddRecruitmentPost(client.Database(currentDB), requester, body.Post) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	server.Post("/closerecruitmentpost", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			PostID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && CloseRecruitmentPost(client.Database(currentDB), requester, body.PostID) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	// ?kind=lft&gameid=bgmi&role=&rank=&region=
+	server.Get("/searchrecruitmentposts", func(c *fiber.Ctx) error {
+		return c.JSON(SearchRecruitmentPosts(client.Database(currentDB), c.Query("kind"),
+			c.Query("gameid"), c.Query("role"), c.Query("rank"), c.Query("region")))
+	})
+
+	server.Post("/invitetoteam", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Invite    TeamInvite
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && InviteToTeam(client.Database(currentDB), requester, body.Invite) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	server.Post("/respondtoinvite", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			InviteID  string
+			Accept    bool
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && RespondToInvite(client.Database(currentDB), requester, body.InviteID, body.Accept) {
 			return c.SendStatus(Success)
 		}
 		return c.SendStatus(NotAcceptable)
 	})
 
+	server.Get("/getinvites", func(c *fiber.Ctx) error {
+		return c.JSON(GetInvites(client.Database(currentDB), c.Query("user")))
+	})
+
 	// Add Users Game
 	server.Post("/addgame", func(c *fiber.Ctx) error {
 		gameInfo := &Game{}
@@ -224,6 +354,10 @@ func main() {
 		return c.SendStatus(NotAcceptable)
 	})
 
+	server.Get("/getnotifications", func(c *fiber.Ctx) error {
+		return c.JSON(GetNotifications(client.Database(currentDB), c.Query("user")))
+	})
+
 	server.Post("/addreference", func(c *fiber.Ctx) error {
 		referenceInfo := &Refer{}
 		json.Unmarshal(c.Body(), referenceInfo)
@@ -242,6 +376,82 @@ func main() {
 		return c.SendStatus(NotAcceptable)
 	})
 
+	server.Post("/updateteamprofile", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Team      Team
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && UpdateTeamProfile(client.Database(currentDB), requester, body.Team) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	// multipart form with email, password, teamid and the logo file
+	server.Post("/uploadteamlogo", func(c *fiber.Ctx) error {
+		requester, ok := Authenticate(client.Database(currentDB),
+			Credentials{Email: c.FormValue("email"), Password: c.FormValue("password")})
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		file, err := c.FormFile("logo")
+		if err != nil {
+			return c.SendStatus(NotAcceptable)
+		}
+		extension, err := imageExtension(file)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		teamid := c.FormValue("teamid")
+		if !CanEditTeam(client.Database(currentDB), requester, teamid) {
+			return c.SendStatus(NotAcceptable)
+		}
+		logo := "teams/" + filepath.Base(teamid) + extension
+		os.MkdirAll("./public/teams", 0755)
+		if err := c.SaveFile(file, "./public/"+logo); err != nil {
+			log.Println(err)
+			return c.SendStatus(NotAcceptable)
+		}
+		if SetTeamLogo(client.Database(currentDB), requester, teamid, logo) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	// Public team page
+	server.Get("/teams/:id", func(c *fiber.Ctx) error {
+		page, ok := GetTeamPage(client.Database(currentDB), c.Params("id"))
+		if !ok {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(page)
+	})
+
+	// Organizers set the rating snake seeding uses, teams cannot set their own
+	server.Post("/teams/:id/rating", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Rating    int
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := SetTeamRating(client.Database(currentDB), organizer, c.Params("id"), body.Rating); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	server.Get("/teams/:id/stats", func(c *fiber.Ctx) error {
+		return c.JSON(GetTeamStats(client.Database(currentDB), c.Params("id")))
+	})
+
 	server.Get("/getteams_whole", func(c *fiber.Ctx) error {
 		return c.JSON(GetTeamsWhole(client.Database(currentDB)))
 	})
@@ -291,39 +501,187 @@ func main() {
 		return c.SendStatus(NotAcceptable)
 	})
 
-	server.Post("/addtournament", func(c *fiber.Ctx) error {
-		var tournaments Tournaments
-		json.Unmarshal(c.Body(), &tournaments)
-		if AddTournament(client.Database(currentDB), tournaments) {
+	// Tournaments are addressed by ID or slug, /tournaments/:id
+	// Organizers create tournaments as drafts, they are published through
+	// /tournaments/:id/status
+	server.Post("/tournaments", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester  Credentials
+			Tournament Tournaments
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok || !IsOrganizer(organizer) {
+			return c.SendStatus(NotAcceptable)
+		}
+		if AddTournament(client.Database(currentDB), &body.Tournament) {
+			return c.JSON(body.Tournament)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	// ?game=&status=live,registration_open&tier=&teamtype=&country=PK
+	// &from=&to= (RFC 3339 or 2006-01-02) &minfee=&maxfee=
+	// &sort=start|registration|fee|prize, "-" in front for descending
+	// &limit=&cursor= the NextCursor of the previous page
+	server.Get("/tournaments", func(c *fiber.Ctx) error {
+		search, err := tournamentSearchQuery(c)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		page, err := SearchTournaments(client.Database(currentDB), User{}, search)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(page)
+	})
+
+	// The same query as GET /tournaments for a signed in user, organizers
+	// can list drafts with status=draft
+	server.Post("/tournaments/search", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		search, err := tournamentSearchQuery(c)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		page, err := SearchTournaments(client.Database(currentDB), requester, search)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(page)
+	})
+
+	// Drafts are only shown to organizers, through POST /tournaments/:id
+	server.Get("/tournaments/:id", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		if tournamentID == "" {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		tournament := GetTournament(client.Database(currentDB), tournamentID)
+		if tournament.Status == StatusDraft {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(tournament)
+	})
+
+	server.Post("/tournaments/:id", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		if tournamentID == "" {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		tournament := GetTournament(client.Database(currentDB), tournamentID)
+		if tournament.Status == StatusDraft && !IsOrganizer(requester) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(tournament)
+	})
+
+	server.Post("/tournaments/:id/status", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Status    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && IsOrganizer(organizer) &&
+			TransitionTournament(client.Database(currentDB), tournamentID, body.Status) {
 			return c.SendStatus(Success)
 		}
 		return c.SendStatus(NotAcceptable)
 	})
 
-	server.Post("/addstreamlinkintournament", func(c *fiber.Ctx) error {
-		type StreamLinkAndTornament struct {
-			Tournament string
-			Link       StreamLink
+	// Team registration, done by the captain while registration is open
+	server.Post("/tournaments/:id/teams", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			TeamID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok || !CanEditTeam(client.Database(currentDB), requester, body.TeamID) {
+			return c.SendStatus(NotAcceptable)
+		}
+		team, found := GetTeamByID(client.Database(currentDB), body.TeamID)
+		if !found {
+			return c.SendStatus(NotAcceptable)
+		}
+		placement, err := AddTeamToTournament(client.Database(currentDB), tournamentID, team)
+		if err != nil {
+			var ineligible *EligibilityError
+			if errors.As(err, &ineligible) {
+				return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error(), "Members": ineligible.Members})
+			}
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"Status": placement})
+	})
+
+	server.Post("/tournaments/:id/withdraw", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			TeamID    string
 		}
-		var streamLinkAndTournament StreamLinkAndTornament
-		json.Unmarshal(c.Body(), &streamLinkAndTournament)
-		if AddStreamingLinksToTournament(client.Database(currentDB), streamLinkAndTournament.Tournament, streamLinkAndTournament.Link) {
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && CanEditTeam(client.Database(currentDB), requester, body.TeamID) &&
+			WithdrawTeamFromTournament(client.Database(currentDB), tournamentID, body.TeamID) {
 			return c.SendStatus(Success)
 		}
 		return c.SendStatus(NotAcceptable)
 	})
 
-	server.Get("/gettournaments", func(c *fiber.Ctx) error {
-		return c.JSON(GetTournaments(client.Database(currentDB)))
+	server.Post("/tournaments/:id/streamlinks", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Link      StreamLink
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		if ok && AddStreamingLinksToTournament(client.Database(currentDB), organizer, tournamentID, body.Link) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
 	})
 
-	server.Get("/gettournament", func(c *fiber.Ctx) error {
-		type TournamentBody struct {
-			Tournament string
+	server.Post("/tournaments/:id/results", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Results   []TournamentResult
 		}
-		tournament := TournamentBody{}
-		json.Unmarshal(c.Body(), &tournament)
-		return c.JSON(GetTournament(client.Database(currentDB), tournament.Tournament))
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && FinalizeTournamentResults(client.Database(currentDB), organizer, tournamentID, body.Results) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
 	})
 
 	server.Post("/gettournamentbygame", func(c *fiber.Ctx) error {
@@ -335,34 +693,1183 @@ func main() {
 		return c.JSON(GetTournamentByGame(client.Database(currentDB), tournament.GameID))
 	})
 
-	server.Post("/addqualifierroundintournament", func(c *fiber.Ctx) error {
-		type QualifierAndRounds struct {
-			Tournament string
-			Qualifier  Rounds
+	server.Post("/tournaments/:id/rounds", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Round     Rounds
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		if err := AddQualifierRoundInTournament(client.Database(currentDB), organizer, tournamentID, body.Round); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	server.Post("/tournaments/:id/groupslots", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			Group     Groups
+			TeamID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok || !CanEditTeam(client.Database(currentDB), requester, body.TeamID) {
+			return c.SendStatus(NotAcceptable)
+		}
+		group, err := AddTeamInTournamentGroup(client.Database(currentDB), tournamentID,
+			body.Qualifier, body.Group, body.TeamID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(group)
+	})
+
+	server.Post("/tournaments/:id/slotpreferences", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			TeamID    string
+			Slots     []time.Time
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && CanEditTeam(client.Database(currentDB), requester, body.TeamID) &&
+			SetSlotPreferences(client.Database(currentDB), tournamentID, body.TeamID, body.Slots) {
+			return c.SendStatus(Success)
+		}
+		return c.SendStatus(NotAcceptable)
+	})
+
+	// Organizer seeding, Strategy is random, snake, region or preference
+	server.Post("/tournaments/:id/seed", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			Strategy  string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		groups, err := SeedRound(client.Database(currentDB), organizer, tournamentID, body.Qualifier, body.Strategy)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(groups)
+	})
+
+	server.Post("/tournaments/:id/standings", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			Standings []Standing
 		}
-		qualifierAndRound := QualifierAndRounds{}
-		json.Unmarshal(c.Body(), &qualifierAndRound)
-		if AddQualifierRoundInTournament(client.Database(currentDB), qualifierAndRound.Tournament,
-			qualifierAndRound.Qualifier) {
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if ok && SetGroupStandings(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.Standings) {
 			return c.SendStatus(Success)
 		}
 		return c.SendStatus(NotAcceptable)
 	})
 
-	server.Post("/addteamintournamentgroup", func(c *fiber.Ctx) error {
+	// ?round=QualifierName, every round when empty
+	server.Get("/tournaments/:id/standings", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		standings, found := GetStandings(client.Database(currentDB), tournamentID, c.Query("round"))
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(standings)
+	})
+
+	// Enters a match's results, an empty MatchID adds the group's next match
+	server.Post("/tournaments/:id/matchresults", func(c *fiber.Ctx) error {
 		type Body struct {
-			Tournament string
-			Qualifier  string
-			Group      Groups
-			Team       Team
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			MatchID   string
+			Results   []MatchResult
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		group, err := SetMatchResults(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.MatchID, body.Results)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
 		}
-		teamInQualOfTournament := Body{}
-		json.Unmarshal(c.Body(), &teamInQualOfTournament)
-		return c.JSON(AddTeamInTournamentGroup(client.Database(currentDB), teamInQualOfTournament.Tournament,
-			teamInQualOfTournament.Qualifier, teamInQualOfTournament.Group, teamInQualOfTournament.Team))
+		return c.JSON(group)
 	})
 
-	server.Static("/", "./public")
-	server.Listen(":3000")
+	// Captains send placement and kills for a match with screenshots as a
+	// multipart form, the result waits for an organizer to verify it
+	server.Post("/tournaments/:id/submitresult", func(c *fiber.Ctx) error {
+		requester, ok := Authenticate(client.Database(currentDB),
+			Credentials{Email: c.FormValue("email"), Password: c.FormValue("password")})
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		teamid := c.FormValue("teamid")
+		if !CanEditTeam(client.Database(currentDB), requester, teamid) {
+			return c.SendStatus(NotAcceptable)
+		}
+		placement, err := strconv.Atoi(c.FormValue("placement"))
+		if err != nil {
+			return c.SendStatus(NotAcceptable)
+		}
+		kills, err := strconv.Atoi(c.FormValue("kills"))
+		if err != nil {
+			return c.SendStatus(NotAcceptable)
+		}
+		screenshots, err := saveImages(c, "screenshots", "results", teamid)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		if len(screenshots) == 0 {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": "at least one screenshot is needed"})
+		}
+		submission, err := SubmitMatchResult(client.Database(currentDB), requester, tournamentID,
+			c.FormValue("qualifier"), c.FormValue("groupid"), ResultSubmission{
+				MatchID:     c.FormValue("matchid"),
+				TeamID:      teamid,
+				Placement:   placement,
+				Kills:       kills,
+				Screenshots: screenshots,
+			})
+		if err != nil {
+			removeImages(screenshots)
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(submission)
+	})
+
+	server.Post("/tournaments/:id/reviewresult", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester    Credentials
+			Qualifier    string
+			GroupID      string
+			SubmissionID string
+			Approve      bool
+			Note         string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		group, err := ReviewMatchResult(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.SubmissionID, body.Approve, body.Note)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(group)
+	})
+
+	// Organizer view of a group's submissions and the conflicts between them
+	server.Post("/tournaments/:id/submissions", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		submissions, err := GetResultSubmissions(client.Database(currentDB), organizer, tournamentID, body.Qualifier, body.GroupID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(submissions)
+	})
+
+	server.Post("/tournaments/:id/pointtable", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester  Credentials
+			PointTable PointTable
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := SetPointTable(client.Database(currentDB), organizer, tournamentID, body.PointTable); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Countries are ISO codes or names, Mode is allow or deny
+	server.Post("/tournaments/:id/eligibility", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Countries []string
+			Mode      string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := SetEligibility(client.Database(currentDB), organizer, tournamentID, body.Countries, body.Mode); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Completes a round and fills the next one with its qualifiers
+	server.Post("/tournaments/:id/completeround", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester   Credentials
+			Qualifier   string
+			Advancement RoundAdvancement
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		groups, err := CompleteRound(client.Database(currentDB), organizer, tournamentID, body.Qualifier, body.Advancement)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(groups)
+	})
+
+	// Builds an elimination round's bracket, Seeds are teamids best first and
+	// default to the previous round's qualifiers
+	server.Post("/tournaments/:id/bracket", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			Seeds     []string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		bracket, err := GenerateBracket(client.Database(currentDB), organizer, tournamentID, body.Qualifier, body.Seeds)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(bracket)
+	})
+
+	server.Post("/tournaments/:id/bracket/report", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			MatchID   string
+			ScoreA    int
+			ScoreB    int
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		bracket, err := ReportBracketMatch(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.MatchID, body.ScoreA, body.ScoreB)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(bracket)
+	})
+
+	// ?round=QualifierName
+	server.Get("/tournaments/:id/bracket", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		bracket, found := GetBracket(client.Database(currentDB), tournamentID, c.Query("round"))
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(bracket)
+	})
+
+	// Sets up a Swiss or round robin round, Seeds work like the bracket ones
+	server.Post("/tournaments/:id/stage", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			Seeds     []string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		stage, err := GenerateStage(client.Database(currentDB), organizer, tournamentID, body.Qualifier, body.Seeds)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(stage)
+	})
 
+	server.Post("/tournaments/:id/stage/report", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			MatchID   string
+			ScoreA    int
+			ScoreB    int
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		stage, err := ReportStageMatch(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.MatchID, body.ScoreA, body.ScoreB)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(stage)
+	})
+
+	// ?round=QualifierName
+	server.Get("/tournaments/:id/stage", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		stage, found := GetStage(client.Database(currentDB), tournamentID, c.Query("round"))
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(stage)
+	})
+
+	// Captains raise a dispute as a multipart form with evidence images
+	server.Post("/tournaments/:id/disputes", func(c *fiber.Ctx) error {
+		requester, ok := Authenticate(client.Database(currentDB),
+			Credentials{Email: c.FormValue("email"), Password: c.FormValue("password")})
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		teamid := c.FormValue("teamid")
+		if !CanEditTeam(client.Database(currentDB), requester, teamid) {
+			return c.SendStatus(NotAcceptable)
+		}
+		evidence, err := saveImages(c, "evidence", "disputes", teamid)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		dispute, err := RaiseDispute(client.Database(currentDB), requester, Dispute{
+			TournamentID: ResolveTournamentID(client.Database(currentDB), c.Params("id")),
+			Qualifier:    c.FormValue("qualifier"),
+			GroupID:      c.FormValue("groupid"),
+			MatchID:      c.FormValue("matchid"),
+			TeamID:       teamid,
+			Reason:       c.FormValue("reason"),
+			Evidence:     evidence,
+		})
+		if err != nil {
+			removeImages(evidence)
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(dispute)
+	})
+
+	// Status is open or resolved, all when empty. Players only get their
+	// teams' disputes.
+	server.Post("/tournaments/:id/disputes/list", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Status    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		return c.JSON(GetDisputes(client.Database(currentDB), requester, tournamentID, body.Status))
+	})
+
+	server.Post("/disputes/:id", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		dispute, err := ViewDispute(client.Database(currentDB), requester, c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(dispute)
+	})
+
+	// Multipart form with email, password, message and evidence images
+	server.Post("/disputes/:id/comments", func(c *fiber.Ctx) error {
+		requester, ok := Authenticate(client.Database(currentDB),
+			Credentials{Email: c.FormValue("email"), Password: c.FormValue("password")})
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		evidence, err := saveImages(c, "evidence", "disputes", c.Params("id"))
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		dispute, err := CommentOnDispute(client.Database(currentDB), requester, c.Params("id"), c.FormValue("message"), evidence)
+		if err != nil {
+			removeImages(evidence)
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(dispute)
+	})
+
+	server.Post("/disputes/:id/assign", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			AssignTo  string // organizer's user_uuid
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := AssignDispute(client.Database(currentDB), requester, c.Params("id"), body.AssignTo); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Outcome is amended, penalty or rejected, Results correct the disputed
+	// match when amending and Penalty is issued for a penalty
+	server.Post("/disputes/:id/resolve", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester  Credentials
+			Outcome    string
+			Resolution string
+			Results    []MatchResult
+			Penalty    Penalty
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		dispute, err := ResolveDispute(client.Database(currentDB), organizer, c.Params("id"),
+			body.Outcome, body.Resolution, body.Results, body.Penalty)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(dispute)
+	})
+
+	// Kind is deduction, forfeit or disqualification, a User_uuid aims it at
+	// one player of the team
+	server.Post("/tournaments/:id/penalties", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Penalty   Penalty
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		body.Penalty.TournamentID = ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		penalty, err := IssuePenalty(client.Database(currentDB), organizer, body.Penalty)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(penalty)
+	})
+
+	server.Get("/tournaments/:id/penalties", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		return c.JSON(GetPenalties(client.Database(currentDB), tournamentID))
+	})
+
+	server.Post("/penalties/:id/reverse", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Note      string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := ReversePenalty(client.Database(currentDB), organizer, c.Params("id"), body.Note); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	server.Get("/tournaments/:id/prizes", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		prizes, found := GetPrizes(client.Database(currentDB), tournamentID)
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(prizes)
+	})
+
+	// Players of the group read its room shortly before it starts
+	server.Post("/tournaments/:id/room", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		room, err := GetRoomCredentials(client.Database(currentDB), requester, tournamentID, body.Qualifier, body.GroupID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(room)
+	})
+
+	// Sets or rotates a group's room
+	server.Post("/tournaments/:id/room/set", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			RoomID    string
+			Password  string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		room, err := SetRoomCredentials(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.RoomID, body.Password)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(room)
+	})
+
+	// Who read the rooms, GroupID narrows it to one group
+	server.Post("/tournaments/:id/room/views", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			GroupID   string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		views, err := GetCredentialViews(client.Database(currentDB), organizer, tournamentID, body.GroupID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(views)
+	})
+
+	server.Post("/tournaments/:id/checkin", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			TeamID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		if err := CheckIn(client.Database(currentDB), requester, tournamentID, body.Qualifier, body.GroupID, body.TeamID); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Organizer's check-in dashboard for a round
+	server.Post("/tournaments/:id/checkins", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		dashboard, err := GetCheckInDashboard(client.Database(currentDB), organizer, tournamentID, body.Qualifier)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(dashboard)
+	})
+
+	// Lays the Template's matches out for a group, or for every group of the
+	// round when GroupID is empty
+	server.Post("/tournaments/:id/matches/schedule", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			Template  MatchTemplate
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		groups, err := ScheduleMatches(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.Template)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(groups)
+	})
+
+	server.Post("/tournaments/:id/matches", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			Match     Match
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		match, err := AddMatch(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, body.Match)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(match)
+	})
+
+	// Only the fields given in Match change
+	server.Post("/tournaments/:id/matches/:matchid", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+			Match     Match
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		match, err := UpdateMatch(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, c.Params("matchid"), body.Match)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(match)
+	})
+
+	server.Post("/tournaments/:id/matches/:matchid/delete", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Qualifier string
+			GroupID   string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		err := DeleteMatch(client.Database(currentDB), organizer, tournamentID,
+			body.Qualifier, body.GroupID, c.Params("matchid"))
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// ?round=QualifierName&group=GroupID, every group of the round without group
+	server.Get("/tournaments/:id/matches", func(c *fiber.Ctx) error {
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		matches, found := GetMatches(client.Database(currentDB), tournamentID, c.Query("round"), c.Query("group"))
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(matches)
+	})
+
+	// Saves Template, or the setup of FromTournament when it is given
+	server.Post("/templates", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester      Credentials
+			Template       TournamentTemplate
+			FromTournament string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		fromTournamentID := ""
+		if body.FromTournament != "" {
+			fromTournamentID = ResolveTournamentID(client.Database(currentDB), body.FromTournament)
+			if fromTournamentID == "" {
+				return c.SendStatus(fiber.StatusNotFound)
+			}
+		}
+		template, err := SaveTournamentTemplate(client.Database(currentDB), organizer, body.Template, fromTournamentID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(template)
+	})
+
+	// ?game=GameID
+	server.Get("/templates", func(c *fiber.Ctx) error {
+		return c.JSON(GetTournamentTemplates(client.Database(currentDB), c.Query("game")))
+	})
+
+	server.Get("/templates/:id", func(c *fiber.Ctx) error {
+		template, found := GetTournamentTemplate(client.Database(currentDB), c.Params("id"))
+		if !found {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.JSON(template)
+	})
+
+	server.Post("/templates/:id/delete", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := DeleteTournamentTemplate(client.Database(currentDB), organizer, c.Params("id")); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Creates a draft tournament from the template, Dates needs at least
+	// TournamentStartDate
+	server.Post("/templates/:id/instantiate", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Title     string
+			Dates     TournamentDates
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournament, err := InstantiateTemplate(client.Database(currentDB), organizer, c.Params("id"), body.Title, body.Dates)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(tournament)
+	})
+
+	// Copies the tournament without its teams and results, on the same dates
+	// when Dates is empty
+	server.Post("/tournaments/:id/clone", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Title     string
+			Dates     TournamentDates
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		tournamentID := ResolveTournamentID(client.Database(currentDB), c.Params("id"))
+		tournament, err := CloneTournament(client.Database(currentDB), organizer, tournamentID, body.Title, body.Dates)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(tournament)
+	})
+
+	// Scrims are free recurring practice lobbies, see Scrim.Schedule
+	server.Post("/scrims", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Scrim     Scrim
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		scrim, err := AddScrim(client.Database(currentDB), organizer, body.Scrim)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(scrim)
+	})
+
+	// ?game=GameID
+	server.Get("/scrims", func(c *fiber.Ctx) error {
+		return c.JSON(GetScrims(client.Database(currentDB), c.Query("game")))
+	})
+
+	// Replaces the scrim's settings, Active false pauses it
+	server.Post("/scrims/:id", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Scrim     Scrim
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		scrim, err := UpdateScrim(client.Database(currentDB), organizer, c.Params("id"), body.Scrim)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(scrim)
+	})
+
+	// Pauses the scrim with Active false and resumes it with true
+	server.Post("/scrims/:id/active", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Active    bool
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := SetScrimActive(client.Database(currentDB), organizer, c.Params("id"), body.Active); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Lobbies still to start
+	server.Get("/scrims/:id/lobbies", func(c *fiber.Ctx) error {
+		return c.JSON(GetScrimLobbies(client.Database(currentDB), c.Params("id")))
+	})
+
+	server.Post("/scrimlobbies/:id/join", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			TeamID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		lobby, err := JoinScrimLobby(client.Database(currentDB), requester, c.Params("id"), body.TeamID)
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(lobby)
+	})
+
+	server.Post("/scrimlobbies/:id/leave", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			TeamID    string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := LeaveScrimLobby(client.Database(currentDB), requester, c.Params("id"), body.TeamID); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Players of the lobby's teams read its room shortly before it starts
+	server.Post("/scrimlobbies/:id/room", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		room, err := GetScrimRoom(client.Database(currentDB), requester, c.Params("id"))
+		if err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.JSON(room)
+	})
+
+	server.Post("/scrimlobbies/:id/room/set", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			RoomID    string
+			Password  string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		organizer, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok {
+			return c.SendStatus(NotAcceptable)
+		}
+		if err := SetScrimRoom(client.Database(currentDB), organizer, c.Params("id"), body.RoomID, body.Password); err != nil {
+			return c.Status(NotAcceptable).JSON(fiber.Map{"Error": err.Error()})
+		}
+		return c.SendStatus(Success)
+	})
+
+	// Result screenshots and dispute evidence, only for the team that sent
+	// them and organizers
+	server.Post("/uploads", func(c *fiber.Ctx) error {
+		type Body struct {
+			Requester Credentials
+			Path      string
+		}
+		body := Body{}
+		json.Unmarshal(c.Body(), &body)
+		requester, ok := Authenticate(client.Database(currentDB), body.Requester)
+		if !ok || !CanViewUpload(client.Database(currentDB), requester, body.Path) {
+			return c.SendStatus(NotAcceptable)
+		}
+		return c.SendFile(filepath.Join(uploadsDir, filepath.Clean("/"+body.Path)))
+	})
+
+	server.Static("/", "./public")
+	server.Listen(":3000")
+
+}
+
+// uploadsDir keeps screenshots and evidence out of ./public, they are only
+// handed out by POST /uploads
+const uploadsDir = "./uploads"
+
+const maxImageSize = 4 << 20
+const maxImages = 5
+
+// imageExtensions are the image types accepted as uploads, by their sniffed
+// content type
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// imageExtension checks the size of an uploaded image and gives the
+// extension its type is stored with. The file name and the client's content
+// type are not trusted, only what the first bytes look like.
+func imageExtension(file *multipart.FileHeader) (string, error) {
+	if file.Size > maxImageSize {
+		return "", errors.New(file.Filename + " is larger than 4 MB")
+	}
+	content, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(content, head)
+	content.Close()
+	extension, ok := imageExtensions[http.DetectContentType(head[:n])]
+	if !ok {
+		return "", errors.New("only png and jpg images are accepted")
+	}
+	return extension, nil
+}
+
+// saveImages stores the png and jpg files of a multipart field under
+// uploads/<dir>, the paths it returns are relative to uploads/
+func saveImages(c *fiber.Ctx, field string, dir string, prefix string) ([]string, error) {
+	saved := []string{}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return saved, err
+	}
+	files := form.File[field]
+	if len(files) > maxImages {
+		return saved, errors.New("at most " + strconv.Itoa(maxImages) + " images can be sent")
+	}
+	extensions := []string{}
+	for _, file := range files {
+		extension, err := imageExtension(file)
+		if err != nil {
+			return saved, err
+		}
+		extensions = append(extensions, extension)
+	}
+	os.MkdirAll(filepath.Join(uploadsDir, dir), 0755)
+	for i, file := range files {
+		path := fmt.Sprintf("%s/%s-%d-%d%s", dir, filepath.Base(prefix), time.Now().UnixNano(), i, extensions[i])
+		if err := c.SaveFile(file, filepath.Join(uploadsDir, path)); err != nil {
+			log.Println(err)
+			removeImages(saved)
+			return []string{}, errors.New("could not save " + file.Filename)
+		}
+		saved = append(saved, path)
+	}
+	return saved, nil
+}
+
+func removeImages(paths []string) {
+	for _, path := range paths {
+		os.Remove(filepath.Join(uploadsDir, path))
+	}
+}
+
+// moveLegacyUploads takes the screenshots and evidence saved under ./public
+// before uploads were kept private, their stored paths stay the same
+func moveLegacyUploads() {
+	for _, dir := range []string{"results", "disputes"} {
+		entries, err := os.ReadDir(filepath.Join("./public", dir))
+		if err != nil {
+			continue
+		}
+		os.MkdirAll(filepath.Join(uploadsDir, dir), 0755)
+		for _, entry := range entries {
+			err := os.Rename(filepath.Join("./public", dir, entry.Name()), filepath.Join(uploadsDir, dir, entry.Name()))
+			if err != nil {
+				log.Println(err)
+			}
+		}
+		os.Remove(filepath.Join("./public", dir))
+	}
+}
+
+// tournamentSearchQuery reads the filters, sort and page of a tournament
+// listing from the query string
+func tournamentSearchQuery(c *fiber.Ctx) (TournamentSearch, error) {
+	search := TournamentSearch{
+		GameID:   c.Query("game"),
+		Tier:     c.Query("tier"),
+		TeamType: c.Query("teamtype"),
+		Country:  c.Query("country"),
+		Sort:     c.Query("sort"),
+		Cursor:   c.Query("cursor"),
+	}
+	if status := c.Query("status"); status != "" {
+		search.Statuses = strings.Split(status, ",")
+	}
+	var err error
+	if search.MinFee, err = queryInt(c.Query("minfee"), 0); err != nil {
+		return search, errors.New("minfee is not a number")
+	}
+	if search.MaxFee, err = queryInt(c.Query("maxfee"), -1); err != nil {
+		return search, errors.New("maxfee is not a number")
+	}
+	if search.Limit, err = queryInt(c.Query("limit"), 0); err != nil {
+		return search, errors.New("limit is not a number")
+	}
+	if search.StartsAfter, err = parseQueryTime(c.Query("from")); err != nil {
+		return search, errors.New("from: " + err.Error())
+	}
+	if search.StartsBefore, err = parseQueryEnd(c.Query("to")); err != nil {
+		return search, errors.New("to: " + err.Error())
+	}
+	return search, nil
+}
+
+// parseQueryTime reads an RFC 3339 time or a plain date, empty is unset
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parseQueryEnd reads the end of a range like parseQueryTime, a plain date
+// takes in the whole day
+func parseQueryEnd(value string) (time.Time, error) {
+	at, err := parseQueryTime(value)
+	if err == nil && len(value) == len("2006-01-02") {
+		// the last millisecond, the finest time MongoDB stores
+		at = at.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return at, err
+}
+
+// queryInt reads a number from the query, empty is fallback
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
 }
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type User struct {
 	User_uuid             string //haexr_id
 	Email                 string
@@ -10,27 +12,136 @@ type User struct {
 	Address               string
 	Country               string
 	ProfileImage          string
+	Role                  string // "" for players, "organizer" or "admin"
 	PreferredGames        []Game
 	UserWallet            Wallet
-	UsersGamesInformation []GameInformationOfUser
+	UsersGamesInformation []GameInformationOfUser `bson:"-"` // filled from UsersGameInformation
 }
 
 type Team struct {
 	TeamID      string
-	TeamName    string
+	TeamName    string // unique per game, ignoring case
+	TeamTag     string // short name shown on scoreboards
 	TeamType    string
 	GameID      string
+	Logo        string // path under public/
+	Description string
+	Country     string
+	SocialLinks []SocialLink
+	CaptainID   string // user_uuid of the captain, defaults to the first member
 	UsersInTeam []User
+	Rating      int // seeding strength, higher is stronger
+
+	// only set on the copy registered in a tournament
+	SlotPreferences []time.Time
+}
+
+type SocialLink struct {
+	Platform string
+	Url      string
 }
 
+// TeamPage is the public view of a team, members carry no private details
+type TeamPage struct {
+	TeamID      string
+	TeamName    string
+	TeamTag     string
+	TeamType    string
+	GameID      string
+	Logo        string
+	Description string
+	Country     string
+	SocialLinks []SocialLink
+	CaptainID   string
+	Members     []PublicMember
+	Tournaments []TeamTournamentEntry
+}
+
+type PublicMember struct {
+	User_uuid    string
+	Fname        string
+	Lname        string
+	Country      string
+	ProfileImage string
+	IGN          string
+	Rank         string
+}
+
+type TeamTournamentEntry struct {
+	TournamentID        string
+	Slug                string
+	Title               string
+	GameID              string
+	Banner              string
+	TournamentStartDate time.Time
+	TournamentEndDate   time.Time
+}
+
+// Credentials identify the caller on endpoints that need a signed in user
+type Credentials struct {
+	Email    string
+	Password string
+}
+
+// Substitution is a roster change requested after the roster is locked,
+// kept as the audit trail whether or not an admin approves it
+type Substitution struct {
+	SubstitutionID string
+	TeamID         string
+	OutUser        string // user_uuid leaving the roster
+	InUser         string // user_uuid joining the roster
+	Reason         string
+	RequestedBy    string
+	RequestedAt    time.Time
+	Status         string // pending, approved or rejected
+	ReviewedBy     string
+	ReviewedAt     time.Time
+	ReviewNote     string
+}
+
+// GameInformationOfUser is a user's profile for one game, kept once per
+// user and game in the UsersGameInformation collection
 type GameInformationOfUser struct {
+	User_uuid  string
 	GameID     string
 	Total_time string
 	IGN        string // in game name
-	ID         string // in game id
+	ID         string // in game id, unique per game
+	Rank       string
+	Region     string
 	TeamId     string // which game
 }
 
+// RecruitmentPost is an entry on the looking for team board, players post
+// "lft" availability and teams post "lfp" open slots
+type RecruitmentPost struct {
+	PostID    string
+	Kind      string // lft or lfp
+	GameID    string
+	User_uuid string // author of an lft post
+	TeamID    string // team of an lfp post
+	Role      string
+	Rank      string
+	Region    string
+	Slots     int // open slots on an lfp post
+	Note      string
+	Open      bool
+	CreatedAt time.Time
+}
+
+// TeamInvite is sent by a captain to a player, accepting it adds the player
+// to the team
+type TeamInvite struct {
+	InviteID    string
+	TeamID      string
+	User_uuid   string
+	PostID      string
+	InvitedBy   string
+	Status      string // pending, accepted or declined
+	CreatedAt   time.Time
+	RespondedAt time.Time
+}
+
 type Game struct {
 	GameID       string
 	GameName     string
@@ -51,9 +162,18 @@ type Transaction struct {
 	Transaction_id string
 	Wallet_id      string
 	Source         string
+	Amount         int // negative when taken from the wallet
 	Timestamp      string
 }
 
+type Notification struct {
+	NotificationID string
+	User_uuid      string
+	Message        string
+	CreatedAt      time.Time
+	Read           bool
+}
+
 type Refer struct {
 	Refer_id          string
 	Produce_user_uuid string // who generated this reference
@@ -74,24 +194,248 @@ type Matches struct {
 
 // ----
 type Tournaments struct {
+	TournamentID          string // generated, never changes
+	Slug                  string // URL friendly title, unique
 	Banner                string
-	Title                 string
+	Title                 string // unique per game, ignoring case
 	GameID                string
 	Sponsor               string
 	Entrancefee           int
-	RegistrationStartDate string
-	RegistrationLastDate  string
-	TournamentStartDate   string
-	TournamentEndDate     string
+	RegistrationStartDate time.Time // all dates are stored in UTC
+	RegistrationLastDate  time.Time
+	TournamentStartDate   time.Time
+	TournamentEndDate     time.Time
+	TimeZone              string // organizer's IANA zone, "Asia/Karachi"
+	RoomRevealMinutes     int    // room credentials show this long before a group starts, 15 when 0
+	CheckInMinutes        int    // check-in opens this long before a group starts, no check-in when 0
+	CheckInCloseMinutes   int    // and closes this long before it starts, 10 when 0
+	NoShowPolicy          string // "forfeit" (default) or "replace" from the waitlist for first round teams that miss check-in
 	TournamentsTeamType   string
-	EligibleCountries     []string
-	TotalTeams            int // total number of teams that can join this tournament
+	EligibleCountries     []string // ISO 3166 alpha-2 codes, "PK", "IN", "BD"
+	EligibilityMode       string   // "allow" (default) only admits the listed countries, "deny" shuts them out
+	UnknownCountries      []string // legacy entries that are not a country, nobody is admitted until the organizer fixes the list
+	TotalTeams            int      // total number of teams that can join this tournament
 	StreamLinks           []StreamLink
 	Teams                 []Team //to be considered, also will be broken down into groups
+	Waitlist              []Team // promoted in order when a registered team withdraws
 	Winnings              string
-	Rounds                []Rounds //the cards in it
-	PointTable            string
+	PrizePool             int        // cash shared out by PrizeSplit
+	PrizeSplit            []int      // percent of the pool for 1st, 2nd ...
+	Rounds                []Rounds   //the cards in it
+	PointTable            PointTable // battle royale scoring, the default table when empty
+	Tier                  string
+	Season                string // "2022-S1", the start year when empty
+	Status                string // one of the Status constants below
+}
+
+// TournamentTemplate is a tournament's setup saved for reuse, every instance
+// gets the template's rounds, scoring, prizes and rules on its own dates
+type TournamentTemplate struct {
+	TemplateID string
+	Name       string // unique per game, ignoring case
+	GameID     string
+	CreatedBy  string // user_uuid
+	CreatedAt  time.Time
+	Tournament Tournaments // no teams or results, its TournamentStartDate anchors the other dates
+}
+
+// TournamentDates are the dates of a new instance, only TournamentStartDate
+// is needed, the others keep their distance to it from the template
+type TournamentDates struct {
+	RegistrationStartDate time.Time
+	RegistrationLastDate  time.Time
+	TournamentStartDate   time.Time
+	TournamentEndDate     time.Time
+}
+
+// Scrim is a recurring practice lobby, a ScrimLobby is opened every time its
+// schedule comes round. Scrims have no entrance fee and no prizes.
+type Scrim struct {
+	ScrimID           string
+	Title             string
+	GameID            string
+	TeamType          string // any team type when empty
+	MapName           string
+	Schedule          string // five field cron in TimeZone, "0 20 * * *" is daily at 8pm, or @hourly, @daily, @weekly
+	TimeZone          string // organizer's IANA zone, "Asia/Karachi" when empty
+	MaxTeams          int
+	RegistrationHours int // lobbies open this long before they start, 24 when 0
+	Active            bool
+	Organizer         string // user_uuid
+	CreatedAt         time.Time
+	LastLobbyAt       time.Time // start of the latest lobby generated
+}
+
+// ScrimLobby is one practice session of a scrim
+type ScrimLobby struct {
+	LobbyID     string
+	ScrimID     string
+	Title       string
+	GameID      string
+	TeamType    string
+	MapName     string
+	StartingAt  time.Time
+	MaxTeams    int
+	Teams       []Team
+	RoomID      string `json:"-"` // only handed out by GetScrimRoom
+	Password    string `json:"-"`
+	RoomVersion int
+	RoomSent    bool // the teams were told the room is ready
+}
+
+// TournamentSummary is a tournament as listed by /tournaments, the full
+// document only comes from /tournaments/:id
+type TournamentSummary struct {
+	TournamentID          string
+	Slug                  string
+	Banner                string
+	Title                 string
+	GameID                string
+	Sponsor               string
+	Entrancefee           int
+	RegistrationStartDate time.Time
+	RegistrationLastDate  time.Time
+	TournamentStartDate   time.Time
+	TournamentEndDate     time.Time
+	TimeZone              string
+	TournamentsTeamType   string
+	EligibleCountries     []string
+	EligibilityMode       string
+	TotalTeams            int
+	RegisteredTeams       int
+	PrizePool             int
 	Tier                  string
+	Season                string
+	Status                string
+}
+
+// TournamentSearch narrows and orders a tournament listing, unset filters
+// match everything
+type TournamentSearch struct {
+	GameID       string
+	Statuses     []string // every status but draft when empty
+	Tier         string
+	TeamType     string
+	Country      string    // ISO code or name, only tournaments it is eligible for
+	StartsAfter  time.Time // TournamentStartDate range
+	StartsBefore time.Time
+	MinFee       int
+	MaxFee       int    // no upper bound when negative
+	Sort         string // start, registration, fee or prize, "-" in front for descending
+	Limit        int    // 20 when 0, at most 100
+	Cursor       string // NextCursor of the previous page
+}
+
+// TournamentPage is one page of a listing
+type TournamentPage struct {
+	Tournaments []TournamentSummary
+	NextCursor  string // empty on the last page
+}
+
+// Tournament lifecycle, see tournamentTransitions for the allowed moves
+const (
+	StatusDraft              = "draft"
+	StatusPublished          = "published"
+	StatusRegistrationOpen   = "registration_open"
+	StatusRegistrationClosed = "registration_closed"
+	StatusLive               = "live"
+	StatusCompleted          = "completed"
+	StatusCancelled          = "cancelled"
+)
+
+// PointTable is a tournament's battle royale scoring
+type PointTable struct {
+	PlacementPoints []int    // points for 1st, 2nd ... later places score nothing
+	KillPoints      int      // points per kill
+	TieBreakers     []string // applied in order when points are level, see the TieBreak constants
+	Description     string   // shown to players, legacy text point tables end up here
+}
+
+// Tie breakers of a PointTable
+const (
+	TieBreakKills         = "kills"
+	TieBreakBestPlacement = "best_placement"
+	TieBreakLastPlacement = "last_placement"
+)
+
+// TournamentResult is a team's finalized outcome in one tournament, team
+// history and statistics are built from these
+type TournamentResult struct {
+	TournamentID string
+	Title        string
+	TeamID       string
+	GameID       string
+	Season       string
+	RoundReached string // QualifierName of the last round the team played
+	Placement    int
+	Kills        int
+	Points       int
+	Winnings     int
+	FinalizedBy  string
+	FinalizedAt  time.Time
+}
+
+type StatLine struct {
+	Tournaments      int
+	Wins             int
+	BestPlacement    int
+	Placed           int     // tournaments with a placement
+	AveragePlacement float64 // over the placed tournaments only
+	Kills            int
+	Points           int
+	Winnings         int
+}
+
+type TeamStats struct {
+	TeamID    string
+	Overall   StatLine
+	PerGame   map[string]StatLine
+	PerSeason map[string]StatLine
+	History   []TournamentResult
+}
+
+// Penalty is an organizer's sanction on a team or one of its players within
+// a tournament. It stays as the audit record and is undone by reversing it.
+type Penalty struct {
+	PenaltyID    string
+	TournamentID string
+	Kind         string // deduction, forfeit or disqualification
+	TeamID       string
+	User_uuid    string // set when a single player is sanctioned
+	Qualifier    string // round of a deduction or forfeit
+	GroupID      string
+	MatchID      string // match a forfeit scores nothing in
+	Points       int    // points a deduction takes off
+	Reason       string
+	DisputeID    string // dispute the penalty came out of
+	IssuedBy     string
+	IssuedAt     time.Time
+	Reversed     bool
+	ReversedBy   string
+	ReversedAt   time.Time
+	ReversalNote string
+}
+
+// PrizeLine is one paid place of a tournament
+type PrizeLine struct {
+	Placement int
+	TeamID    string
+	TeamName  string
+	Amount    int
+}
+
+type PrizeDistribution struct {
+	PrizePool int
+	Source    string // "results" when finalized results decide the places, "standings" otherwise
+	Lines     []PrizeLine
+}
+
+// IneligibleMember names a team member whose country keeps the team out of
+// a tournament
+type IneligibleMember struct {
+	User_uuid string
+	Name      string
+	Country   string
 }
 
 type StreamLink struct {
@@ -103,33 +447,238 @@ type StreamLink struct {
 // can be of 3 hours maybe for 3 group added by kundan himself
 type Rounds struct {
 	QualifierName                 string
-	Dates                         []string //spans over Group StartingAtDate
-	Times                         []string //spans over Group StartingAtTime
+	Slots                         []time.Time //spans over Group StartingAt
 	Groups                        []Groups
 	NumOfQualifyingTeamsThisRound int //how many teams will be qualifying for this round
 	MapName                       string
 	IsLocked                      bool
+	LockAt                        time.Time //rosters freeze once this passes
 	NumberOfTeamsPerGroup         int
+	QualifiedTeams                []string       // teamids sent to the next round when this one completed
+	Format                        string         // one of the Format constants, battle royale groups when empty
+	Bracket                       *Bracket       // elimination rounds only
+	Stage                         *Stage         // Swiss and round robin rounds only
+	SwissRounds                   int            // rounds a Swiss stage plays, enough to leave one unbeaten team when 0
+	MatchTemplate                 *MatchTemplate // the last schedule given to the round's groups
+	Version                       int            // goes up every time teams are placed in or taken out of the groups
+}
+
+// Round formats
+const (
+	FormatBattleRoyale      = "battle_royale"
+	FormatSingleElimination = "single_elimination"
+	FormatDoubleElimination = "double_elimination"
+	FormatSwiss             = "swiss"
+	FormatRoundRobin        = "round_robin"
+)
+
+// Bracket is an elimination round, matches point at the match their winner
+// and loser move on to
+type Bracket struct {
+	Format   string
+	Matches  []HeadToHeadMatch
+	Champion string // teamid, set once the final is decided
+	Version  int    // goes up with every reported match
+}
+
+// HeadToHeadMatch is one match between two teams
+type HeadToHeadMatch struct {
+	MatchID    string // "W1-1", "L2-3", "GF1", "GF2" in brackets, "S2-1" or "A3-2" in stages
+	Side       string // winners, losers or final in a bracket
+	Group      string // round robin pool, "Group A"
+	Round      int
+	Position   int
+	StartingAt time.Time
+	TeamA      string // teamid, empty for a bye or while waiting
+	TeamB      string
+	ReadyA     bool // TeamA is decided, even if it is a bye
+	ReadyB     bool
+	ScoreA     int
+	ScoreB     int
+	Winner     string // empty for a drawn stage match
+	Loser      string
+	Status     string // pending, ready, completed, bye or void
+	WinnerTo   string // MatchID the winner moves to
+	WinnerSlot string // "A" or "B"
+	LoserTo    string
+	LoserSlot  string
+}
+
+// Stage is a Swiss or round robin round, teams play a set of head to head
+// matches and are ranked on a table instead of being knocked out
+type Stage struct {
+	Format       string
+	Seeds        []string // teamids, best first
+	Rounds       int      // Swiss rounds to play, or the longest pool schedule
+	CurrentRound int      // the Swiss round that has been paired
+	Matches      []HeadToHeadMatch
+	Table        []StageStanding // ranked within each group
+	Version      int             // goes up with every reported match
+}
+
+type StageStanding struct {
+	TeamID    string
+	Group     string // round robin pool, empty in Swiss
+	Played    int
+	Wins      int
+	Draws     int
+	Losses    int
+	Points    int // 3 for a win or a bye, 1 for a draw
+	Buchholz  int // Swiss only, the sum of the opponents' points
+	ScoreDiff int
+	Rank      int
+}
+
+// RoundAdvancement is the organizer's input when completing a round
+type RoundAdvancement struct {
+	Include   []string // teamids that qualify whatever their rank
+	Exclude   []string // teamids that cannot qualify
+	Wildcards []string // teamids added on top of the qualifying teams
 }
 
 type Groups struct {
-	GroupID        string
-	MatchID        string //BGMI MATCH #7768
-	Group          string
-	Teams          []Team
-	Rounds         []Match  // the rounds to be played in between the pool of teams coming froma action sheet from below
-	Results        []string // will conatain the screenshots and some data
-	StartingAtTime string
-	Duration       string
-	StartingAtDate string
-	RoomID         string
-	Password       string
+	GroupID          string
+	MatchID          string //BGMI MATCH #7768
+	Group            string
+	Teams            []Team
+	Rounds           []Match            // the rounds to be played in between the pool of teams coming froma action sheet from below
+	Results          []ResultSubmission // captains' claims with their screenshots
+	StartingAt       time.Time
+	Duration         string
+	RoomID           string   `json:"-"` // only handed out by GetRoomCredentials
+	Password         string   `json:"-"`
+	RoomVersion      int      // goes up every time the credentials are set
+	CheckedIn        []string // teamids whose captain confirmed attendance
+	NoShows          []string // teamids that missed check-in
+	CheckInProcessed bool     // no-shows have been dealt with
+	Standings        []Standing
+	OpenDisputes     int // the standings are frozen while any dispute is open
+	Version          int // goes up with every change to the matches and results
+}
+
+// ResultSubmission is a captain's claim of how their team finished a match,
+// it only counts once an organizer verifies it
+type ResultSubmission struct {
+	SubmissionID string
+	MatchID      string
+	TeamID       string
+	Placement    int
+	Kills        int
+	Screenshots  []string // paths under uploads/
+	SubmittedBy  string
+	SubmittedAt  time.Time
+	Status       string // pending, verified or rejected
+	ReviewedBy   string
+	ReviewedAt   time.Time
+	ReviewNote   string
+}
+
+// Dispute is a ticket a team raises against a group's results, the group's
+// standings stay frozen until an organizer resolves it
+type Dispute struct {
+	DisputeID    string
+	TournamentID string
+	Qualifier    string
+	GroupID      string
+	MatchID      string // empty when the whole group is disputed
+	TeamID       string // team that raised it
+	RaisedBy     string
+	Reason       string
+	Evidence     []string // paths under uploads/
+	Comments     []DisputeComment
+	AssignedTo   string // user_uuid of the organizer handling it
+	Status       string // open or resolved
+	Outcome      string // amended, penalty or rejected
+	Resolution   string
+	ResolvedBy   string
+	CreatedAt    time.Time
+	ResolvedAt   time.Time
+}
+
+type DisputeComment struct {
+	User_uuid string
+	Message   string
+	Evidence  []string
+	CreatedAt time.Time
+}
+
+// RoomCredentials are what a group needs to join its custom room
+type RoomCredentials struct {
+	GroupID    string
+	Group      string
+	RoomID     string
+	Password   string
+	Version    int
+	StartingAt time.Time
+}
+
+// CredentialView is the audit record of someone reading room credentials
+type CredentialView struct {
+	TournamentID string
+	Qualifier    string
+	GroupID      string
+	User_uuid    string
+	TeamID       string // empty for organizers
+	Version      int
+	ViewedAt     time.Time
+}
+
+// GroupCheckIn is a group's line on the organizer's check-in dashboard
+type GroupCheckIn struct {
+	GroupID    string
+	Group      string
+	StartingAt time.Time
+	OpensAt    time.Time
+	ClosesAt   time.Time
+	State      string // upcoming, open or closed
+	CheckedIn  int
+	Teams      []TeamCheckIn
+}
+
+type TeamCheckIn struct {
+	TeamID    string
+	TeamName  string
+	CheckedIn bool
+	NoShow    bool
+}
+
+// Standing is a team's line in a group table
+type Standing struct {
+	TeamID        string
+	TeamName      string
+	Points        int
+	Kills         int
+	BestPlacement int
+	LastPlacement int  // placement in the group's last match
+	Deducted      int  // penalty points already taken off Points
+	Disqualified  bool // ranked below everyone else and cannot qualify
+	Rank          int
 }
 
 // match takes place in between the group
 type Match struct {
-	Title   string
-	Time    string
-	Date    string
-	MapName string
+	MatchID    string
+	Title      string
+	StartingAt time.Time
+	Duration   int // minutes
+	MapName    string
+	Status     string // scheduled, live or completed once it has results
+	Results    []MatchResult
+}
+
+// MatchTemplate lays out the matches each group of a battle royale round
+// plays, back to back from the group's StartingAt
+type MatchTemplate struct {
+	Matches  int      // matches per group
+	Maps     []string // rotated through in order, the round's MapName when empty
+	Duration int      // minutes per match
+	Break    int      // minutes between one match ending and the next starting
+}
+
+// MatchResult is one team's finish in a battle royale match
+type MatchResult struct {
+	TeamID    string
+	Placement int
+	Kills     int
+	Points    int // worked out from the tournament's PointTable
 }